@@ -0,0 +1,40 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Write replaces the file with data in one step, so a crash never leaves it half written: data goes to a temporary
+// file next to it first, which is then renamed over it.
+func Write(fileName string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
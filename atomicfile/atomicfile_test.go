@@ -0,0 +1,34 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteReplacesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "entry.json")
+
+	assert.NoError(t, Write(fileName, []byte(`{"attempts":1}`)))
+	assert.NoError(t, Write(fileName, []byte(`{"attempts":2}`)))
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"attempts":2}`, string(data))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "no temporary file may be left behind")
+}
+
+func TestWriteToMissingDirectory(t *testing.T) {
+	err := Write(filepath.Join("missing-directory", "entry.json"), []byte(`{}`))
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	logger "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/transactionid-utils-go"
+)
+
+const (
+	batchPath               = "/content-collection/batch"
+	defaultBatchConcurrency = 4
+	defaultBatchMaxLines    = 1000
+	defaultBatchMaxBytes    = 100 * 1024 * 1024
+	maxBatchLineSize        = 10 * 1024 * 1024
+)
+
+var errBatchTooLarge = errors.New("batch has too many collections")
+
+// batchLine is one line of a batch: a collection document and its type.
+type batchLine struct {
+	CollectionType string          `json:"collectionType"`
+	Collection     json.RawMessage `json:"collection"`
+}
+
+type numberedLine struct {
+	number int
+	data   []byte
+}
+
+// batchResult is the outcome of one line of a batch, streamed back as soon as the line is processed.
+type batchResult struct {
+	Line           int    `json:"line"`
+	UUID           string `json:"uuid,omitempty"`
+	CollectionType string `json:"collectionType,omitempty"`
+	Status         int    `json:"status"`
+	Unfolding      string `json:"unfolding,omitempty"`
+	Added          int    `json:"added"`
+	Removed        int    `json:"removed"`
+	Moved          int    `json:"moved"`
+	Failed         int    `json:"failed"`
+	Error          string `json:"error,omitempty"`
+}
+
+// batchError is the last line of the results of a batch that could not be read whole.
+type batchError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// handleBatch runs every line of a newline-delimited batch through the same flow as a PUT, a few lines at a time,
+// and answers with one result line per batch line in the order they finish.
+// The lines are processed as soon as they are read. HTTP/1.x does not allow reading the request after the response
+// started though, so the results of the lines processed while the batch is read are kept until it is read whole.
+// A batch that turns out to be invalid once some of its lines were processed still gets their results, followed by
+// a batchError line, as the status of the response cannot take back what was written.
+func (u *unfolder) handleBatch(writer http.ResponseWriter, req *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	writer.Header().Add(transactionidutils.TransactionIDHeader, tid)
+
+	if req.ContentLength > u.batchMaxBytes {
+		logger.Errorf("Message with tid=%v Skip batch. Its [%v] bytes are over the limit of [%v]", tid, req.ContentLength, u.batchMaxBytes)
+		writer.Header().Add("Content-Type", "application/json;charset=utf-8")
+		writeError(writer, http.StatusRequestEntityTooLarge, fmt.Errorf("batch is too large: at most [%d] bytes are allowed", u.batchMaxBytes))
+		return
+	}
+
+	body := http.MaxBytesReader(writer, req.Body, u.batchMaxBytes)
+	defer body.Close()
+
+	lines := make(chan numberedLine)
+	read := make(chan error, 1)
+	go func() {
+		read <- readBatchLines(body, lines, u.batchMaxLines)
+	}()
+
+	results := u.unfoldBatch(req.Context(), tid, lines)
+	done := []batchResult{}
+	var err error
+	for reading := true; reading; {
+		select {
+		case result := <-results:
+			done = append(done, result)
+		case err = <-read:
+			reading = false
+		}
+	}
+
+	if err != nil {
+		// the lines already read are processed anyway, their results tell the client what was written
+		for result := range results {
+			done = append(done, result)
+		}
+		logger.Errorf("Message with tid=%v Unable to read batch: %v. Processed [%v] collections", tid, err, len(done))
+		if len(done) == 0 {
+			writer.Header().Add("Content-Type", "application/json;charset=utf-8")
+			writeError(writer, batchErrorStatus(err), err)
+			return
+		}
+	} else {
+		logger.Infof("Message with tid=%v Processing batch, [%v] collections processed while reading it", tid, len(done))
+	}
+
+	writer.Header().Add("Content-Type", "application/x-ndjson")
+	writer.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(writer)
+	flusher, _ := writer.(http.Flusher)
+	write := func(line interface{}) {
+		if err := encoder.Encode(line); err != nil {
+			logger.Warnf("Message with tid=%v Unable to write batch results: %v", tid, err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	for _, result := range done {
+		write(result)
+	}
+	for result := range results {
+		write(result)
+	}
+	if err != nil {
+		write(batchError{Status: batchErrorStatus(err), Error: err.Error()})
+	}
+}
+
+// readBatchLines hands the lines of the batch to the workers as they are read, and closes lines when done.
+// It stops reading at the first line above maxLines. Zero means no limit.
+// A line is only handed over once the next one is read or the body ends cleanly, as the scanner also returns the bytes
+// read before an error, like a line cut short by the size limit.
+func readBatchLines(body io.Reader, lines chan<- numberedLine, maxLines int) error {
+	defer close(lines)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxBatchLineSize)
+
+	var pending *numberedLine
+	count := 0
+	for number := 1; scanner.Scan(); number++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if pending != nil {
+			lines <- *pending
+		}
+		count++
+		if maxLines > 0 && count > maxLines {
+			return fmt.Errorf("%w: at most [%d] collections are allowed", errBatchTooLarge, maxLines)
+		}
+		pending = &numberedLine{number: number, data: append([]byte{}, data...)}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if pending == nil {
+		return errors.New("batch has no collections")
+	}
+	lines <- *pending
+	return nil
+}
+
+// batchErrorStatus answers 413 for the batches over one of the limits, and 400 for the others.
+// http.MaxBytesReader tells that the body is too large only through the text of its error.
+func batchErrorStatus(err error) int {
+	if errors.Is(err, errBatchTooLarge) || errors.Is(err, bufio.ErrTooLong) || strings.Contains(err.Error(), "request body too large") {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// unfoldBatch processes the lines with at most batchConcurrency of them at a time.
+// The returned channel is closed once lines is closed and every line is processed.
+func (u *unfolder) unfoldBatch(ctx context.Context, tid string, lines <-chan numberedLine) <-chan batchResult {
+	results := make(chan batchResult)
+	go func() {
+		defer close(results)
+
+		slots := make(chan struct{}, u.batchConcurrency)
+		var wg sync.WaitGroup
+		for line := range lines {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(line numberedLine) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				results <- u.unfoldBatchLine(ctx, tid, line)
+			}(line)
+		}
+		wg.Wait()
+	}()
+	return results
+}
+
+// unfoldBatchLine gives every line the deadline of a request of its own. Cancelling the batch cancels all its lines.
+func (u *unfolder) unfoldBatchLine(ctx context.Context, batchTid string, line numberedLine) batchResult {
+	result := batchResult{Line: line.number}
+
+	parsed := batchLine{}
+	if err := json.Unmarshal(line.data, &parsed); err != nil {
+		result.Status = http.StatusBadRequest
+		result.Error = fmt.Sprintf("unable to parse batch line: %v", err)
+		return result
+	}
+	if parsed.CollectionType == "" || len(parsed.Collection) == 0 {
+		result.Status = http.StatusBadRequest
+		result.Error = "batch line needs a collectionType and a collection"
+		return result
+	}
+
+	var collection struct {
+		UUID string `json:"uuid"`
+	}
+	if err := json.Unmarshal(parsed.Collection, &collection); err != nil {
+		result.Status = http.StatusBadRequest
+		result.Error = fmt.Sprintf("unable to parse collection: %v", err)
+		return result
+	}
+	result.UUID = collection.UUID
+	result.CollectionType = parsed.CollectionType
+
+	ctx, cancel := u.withDeadline(ctx)
+	defer cancel()
+
+	status, report, err := u.putCollection(ctx, fmt.Sprintf("%v_%d", batchTid, line.number), collection.UUID, parsed.CollectionType, parsed.Collection, false)
+	result.Status = status
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Unfolding = report.Unfolding
+	result.Added = len(report.Added)
+	result.Removed = len(report.Removed)
+	result.Moved = len(report.Moved)
+	result.Failed = len(report.Failed)
+	return result
+}
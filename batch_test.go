@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	"github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBatch(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.setBatchConcurrency(2)
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{addedItemUuid},
+		LastModified: lastModified,
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}}
+	contentArr := []map[string]interface{}{{"uuid": addedItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	collection := string(readTestFile(t, inputFile))
+	collection = strings.Join(strings.Fields(collection), "")
+	batch := strings.Join([]string{
+		`{"collectionType":"` + whitelistedCollection + `","collection":` + collection + `}`,
+		``,
+		`{"collectionType":"` + whitelistedCollection + `","collection":{"uuid":"` + invalidUuid + `"}}`,
+		`{"collection":` + collection + `}`,
+		`{`,
+	}, "\n")
+
+	tid := transactionidutils.NewTransactionID()
+	req, err := http.NewRequest(http.MethodPost, server.URL+batchPath, strings.NewReader(batch))
+	assert.NoError(t, err)
+	req.Header.Add(transactionidutils.TransactionIDHeader, tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&relations.CCRelations{}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.MatchedBy(expectString(t, tid+"_1")), mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).Return(contentArr, nil)
+	mcp.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	results := map[int]batchResult{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		result := batchResult{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		results[result.Line] = result
+	}
+	assert.Len(t, results, 4)
+
+	assert.Equal(t, batchResult{Line: 1, UUID: collectionUuid, CollectionType: whitelistedCollection, Status: http.StatusOK, Unfolding: unfoldingDone, Added: 1}, results[1])
+	assert.Equal(t, http.StatusBadRequest, results[3].Status)
+	assert.Equal(t, invalidUuid, results[3].UUID)
+	assert.NotEmpty(t, results[3].Error)
+	assert.Equal(t, http.StatusBadRequest, results[4].Status)
+	assert.NotEmpty(t, results[4].Error)
+	assert.Equal(t, http.StatusBadRequest, results[5].Status)
+	assert.NotEmpty(t, results[5].Error)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
+}
+
+func TestBatch_Empty(t *testing.T) {
+	_, _, _, _, _, _, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+batchPath, "application/x-ndjson", strings.NewReader("\n\n"))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestBatch_TooManyLines(t *testing.T) {
+	_, _, _, _, _, _, u := newUnfolderWithMocks()
+	u.setBatchLimits(2, defaultBatchMaxBytes)
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	batch := strings.Join([]string{`{`, `{`, `{`}, "\n")
+	resp, err := http.Post(server.URL+batchPath, "application/x-ndjson", strings.NewReader(batch))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the lines read before the limit are processed")
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	assert.Len(t, lines, 3)
+
+	last := batchError{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &last))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, last.Status)
+	assert.Contains(t, last.Error, "at most [2] collections")
+}
+
+func TestBatch_TooLarge(t *testing.T) {
+	_, _, _, _, _, _, u := newUnfolderWithMocks()
+	u.setBatchLimits(defaultBatchMaxLines, 16)
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+batchPath, "application/x-ndjson", strings.NewReader(strings.Repeat("{", 32)))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestBatch_TooLargeWithoutContentLength(t *testing.T) {
+	_, _, _, _, _, _, u := newUnfolderWithMocks()
+	u.setBatchLimits(defaultBatchMaxLines, 16)
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	body := ioutil.NopCloser(strings.NewReader(strings.Repeat("{", 32)))
+	resp, err := http.Post(server.URL+batchPath, "application/x-ndjson", body)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode, "nothing was processed before the limit")
+}
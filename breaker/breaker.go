@@ -0,0 +1,206 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// State tells whether a breaker lets the calls through.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// Open fails every call without making it, until the open timeout has passed.
+	Open
+	// HalfOpen lets one probe call through at a time, to find out if the dependency is back.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown [%d]", int(s))
+}
+
+// ErrOpen is returned, wrapped, for the calls failed by an open breaker.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Settings tell when a breaker opens and how it closes again.
+type Settings struct {
+	// FailureThreshold is the number of consecutive failed calls that opens the breaker. 0 means it never opens.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker fails the calls before letting a probe through.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of consecutive successful probes that closes the breaker again. 0 means 1.
+	HalfOpenProbes int
+}
+
+// Breaker stops calling a dependency after it failed FailureThreshold times in a row, so the calls fail fast instead
+// of waiting for timeouts. A call fails when it gets no response or a 5xx one.
+type Breaker struct {
+	mutex     sync.Mutex
+	name      string
+	settings  Settings
+	state     State
+	failures  int
+	successes int
+	probing   bool
+	openedAt  time.Time
+	now       func() time.Time
+	// generation changes with every state change, so that the outcomes of calls allowed in an earlier state are ignored
+	generation uint64
+}
+
+// ticket is handed out by allow for every call let through, and given back to done with the outcome of the call.
+type ticket struct {
+	generation uint64
+	probe      bool
+}
+
+func New(name string, settings Settings) *Breaker {
+	if settings.HalfOpenProbes < 1 {
+		settings.HalfOpenProbes = 1
+	}
+	return &Breaker{name: name, settings: settings, now: time.Now}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State is the current state of the breaker. An open breaker whose timeout has passed is half-open.
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.currentState()
+}
+
+func (b *Breaker) currentState() State {
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.settings.OpenTimeout)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// allow tells if a call may be made now, marking it as the probe if the breaker is half-open.
+func (b *Breaker) allow() (ticket, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.currentState() {
+	case Open:
+		return ticket{}, fmt.Errorf("%w for [%v]", ErrOpen, b.name)
+	case HalfOpen:
+		if b.probing {
+			return ticket{}, fmt.Errorf("%w for [%v]", ErrOpen, b.name)
+		}
+		if b.state != HalfOpen {
+			b.setState(HalfOpen)
+		}
+		b.probing = true
+		return ticket{generation: b.generation, probe: true}, nil
+	}
+	return ticket{generation: b.generation}, nil
+}
+
+// done records the outcome of a call that was allowed. Calls given up by the caller count neither way, nor do the calls
+// allowed before the last state change: a slow call made while closed does not settle the probe of a half-open breaker.
+func (b *Breaker) done(t ticket, failed bool, givenUp bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if t.generation != b.generation {
+		return
+	}
+	if t.probe {
+		b.probing = false
+	}
+	if givenUp {
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		if t.probe {
+			b.successes++
+			if b.successes >= b.settings.HalfOpenProbes {
+				b.setState(Closed)
+			}
+		}
+		return
+	}
+
+	b.failures++
+	if t.probe || (b.settings.FailureThreshold > 0 && b.failures >= b.settings.FailureThreshold) {
+		b.setState(Open)
+		b.openedAt = b.now()
+	}
+}
+
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.generation++
+	b.successes = 0
+	b.probing = false
+}
+
+// Do makes call if the breaker lets it through, and records its outcome: call tells if it failed, along with its error.
+// Use it for calls made of several requests, like retried ones, so that they count once.
+// Calls that fail because ctx was cancelled count neither way.
+func (b *Breaker) Do(ctx context.Context, call func() (bool, error)) error {
+	t, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	failed, err := call()
+	b.done(t, failed, err != nil && errors.Is(ctx.Err(), context.Canceled))
+	return err
+}
+
+// Transport makes the calls through next while the breaker lets them through.
+func (b *Breaker) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{breaker: b, next: next}
+}
+
+// Client returns a copy of client that makes its calls through the breaker.
+func (b *Breaker) Client(client *http.Client) *http.Client {
+	wrapped := *client
+	wrapped.Transport = b.Transport(client.Transport)
+	return &wrapped
+}
+
+type transport struct {
+	breaker *Breaker
+	next    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ticket, err := t.breaker.allow()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	givenUp := err != nil && errors.Is(req.Context().Err(), context.Canceled)
+	t.breaker.done(ticket, err != nil || resp.StatusCode >= http.StatusInternalServerError, givenUp)
+	return resp, err
+}
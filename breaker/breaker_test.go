@@ -0,0 +1,184 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(settings Settings) (*Breaker, *clock) {
+	c := &clock{now: time.Date(2017, 1, 31, 15, 33, 21, 0, time.UTC)}
+	b := New("test-dependency", settings)
+	b.now = func() time.Time { return c.now }
+	return b, c
+}
+
+// statusServer answers with the status currently stored in status, and counts the calls it gets.
+func statusServer(status *int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+	}))
+}
+
+func get(client *http.Client, url string) (int, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	status, calls := int32(http.StatusServiceUnavailable), int32(0)
+	server := statusServer(&status, &calls)
+	defer server.Close()
+
+	b, _ := newTestBreaker(Settings{FailureThreshold: 2, OpenTimeout: time.Minute})
+	client := b.Client(http.DefaultClient)
+
+	for i := 0; i < 2; i++ {
+		code, err := get(client, server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+	}
+	assert.Equal(t, Open, b.State())
+
+	_, err := get(client, server.URL)
+	assert.True(t, errors.Is(err, ErrOpen), "unexpected error %v", err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	status, calls := int32(http.StatusServiceUnavailable), int32(0)
+	server := statusServer(&status, &calls)
+	defer server.Close()
+
+	b, _ := newTestBreaker(Settings{FailureThreshold: 2, OpenTimeout: time.Minute})
+	client := b.Client(http.DefaultClient)
+
+	get(client, server.URL)
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	get(client, server.URL)
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	get(client, server.URL)
+
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerClosesAfterSuccessfulProbes(t *testing.T) {
+	status, calls := int32(http.StatusInternalServerError), int32(0)
+	server := statusServer(&status, &calls)
+	defer server.Close()
+
+	b, c := newTestBreaker(Settings{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenProbes: 2})
+	client := b.Client(http.DefaultClient)
+
+	get(client, server.URL)
+	assert.Equal(t, Open, b.State())
+
+	c.advance(time.Minute)
+	assert.Equal(t, HalfOpen, b.State())
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	code, err := get(client, server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HalfOpen, b.State())
+
+	get(client, server.URL)
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerReopensAfterFailedProbe(t *testing.T) {
+	status, calls := int32(http.StatusInternalServerError), int32(0)
+	server := statusServer(&status, &calls)
+	defer server.Close()
+
+	b, c := newTestBreaker(Settings{FailureThreshold: 3, OpenTimeout: time.Minute})
+	client := b.Client(http.DefaultClient)
+
+	for i := 0; i < 3; i++ {
+		get(client, server.URL)
+	}
+	c.advance(time.Minute)
+
+	// a single failed probe is enough to open the breaker again
+	get(client, server.URL)
+	assert.Equal(t, Open, b.State())
+
+	_, err := get(client, server.URL)
+	assert.True(t, errors.Is(err, ErrOpen), "unexpected error %v", err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestBreakerLetsOneProbeThroughAtATime(t *testing.T) {
+	b, c := newTestBreaker(Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	first, err := b.allow()
+	assert.NoError(t, err)
+	b.done(first, true, false)
+	c.advance(time.Minute)
+
+	probe, err := b.allow()
+	assert.NoError(t, err)
+	_, err = b.allow()
+	assert.True(t, errors.Is(err, ErrOpen))
+
+	// a probe given up by the caller frees the way for the next one
+	b.done(probe, false, true)
+	_, err = b.allow()
+	assert.NoError(t, err)
+}
+
+func TestBreakerIgnoresCallsAllowedBeforeTheLastStateChange(t *testing.T) {
+	b, c := newTestBreaker(Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	slow, err := b.allow()
+	assert.NoError(t, err)
+	failed, err := b.allow()
+	assert.NoError(t, err)
+	b.done(failed, true, false)
+	assert.Equal(t, Open, b.State())
+
+	c.advance(time.Minute)
+	probe, err := b.allow()
+	assert.NoError(t, err)
+
+	// the slow call allowed while closed neither settles the probe nor closes the breaker
+	b.done(slow, false, false)
+	assert.Equal(t, HalfOpen, b.State())
+	_, err = b.allow()
+	assert.True(t, errors.Is(err, ErrOpen), "the probe is still in flight")
+
+	b.done(probe, true, false)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerWithoutThresholdNeverOpens(t *testing.T) {
+	b, _ := newTestBreaker(Settings{})
+	for i := 0; i < 100; i++ {
+		call, err := b.allow()
+		assert.NoError(t, err)
+		b.done(call, true, false)
+	}
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "closed", Closed.String())
+	assert.Equal(t, "open", Open.String())
+	assert.Equal(t, "half-open", HalfOpen.String())
+}
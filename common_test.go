@@ -33,6 +33,24 @@ func buildRequest(t *testing.T, serverUrl string, collection string, uuid string
 	return req
 }
 
+func buildDeleteRequest(t *testing.T, serverUrl string, collection string, uuid string, tid string) *http.Request {
+	req, err := http.NewRequest(http.MethodDelete, serverUrl+buildPath(t, collection, uuid), nil)
+	assert.NoError(t, err)
+
+	req.Header.Add(transactionidutils.TransactionIDHeader, tid)
+
+	return req
+}
+
+func buildPreviewRequest(t *testing.T, serverUrl string, collection string, uuid string, body []byte, tid string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, serverUrl+buildPath(t, collection, uuid)+"/preview", bytes.NewBuffer(body))
+	assert.NoError(t, err)
+
+	req.Header.Add(transactionidutils.TransactionIDHeader, tid)
+
+	return req
+}
+
 func buildPath(t *testing.T, collectionType string, uuid string) string {
 	pathWithCollection := strings.Replace(unfolderPath, "{collectionType}", collectionType, 1)
 	assert.NotEqual(t, unfolderPath, pathWithCollection)
@@ -54,3 +72,12 @@ func readTestFile(t *testing.T, fileName string) []byte {
 
 	return buf.Bytes()
 }
+
+func buildRepublishRequest(t *testing.T, serverUrl string, collection string, uuid string, tid string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, serverUrl+buildPath(t, collection, uuid)+"/republish", nil)
+	assert.NoError(t, err)
+
+	req.Header.Add(transactionidutils.TransactionIDHeader, tid)
+
+	return req
+}
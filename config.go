@@ -9,6 +9,7 @@ type serviceConfig struct {
 	appName                    *string
 	appPort                    *string
 	unfoldingWhitelist         *[]string
+	unfoldingPoliciesFile      *string
 	writerURI                  *string
 	writerHealthURI            *string
 	contentResolverURI         *string
@@ -20,6 +21,40 @@ type serviceConfig struct {
 	kafkaHostname              *string
 	kafkaAuth                  *string
 	requestTimeout             *int
+	asyncUnfolding             *bool
+	asyncWorkers               *int
+	asyncQueueSize             *int
+	asyncDrainTimeout          *int
+	sendFailurePolicy          *string
+	idempotencyStore           *string
+	idempotencyFile            *string
+	idempotencyCapacity        *int
+	idempotencyTTL             *int
+	collectionLockTimeout      *int
+	freshnessCapacity          *int
+	freshnessTTL               *int
+	outboxDir                  *string
+	outboxRetryInterval        *int
+	outboxMaxAttempts          *int
+	batchConcurrency           *int
+	batchMaxLines              *int
+	batchMaxBytes              *int
+	requestDeadline            *int
+	collectionSchemasDir       *string
+	maxCollectionItems         *int
+	writerRetryMaxAttempts     *int
+	writerRetryBaseDelay       *int
+	writerRetryJitter          *int
+	writerRetryStatuses        *[]int
+	breakerFailureThreshold    *int
+	breakerOpenTimeout         *int
+	breakerHalfOpenProbes      *int
+	extraWriterURIs            *[]string
+	writerAggregation          *string
+	shadowWriterURI            *string
+	shadowWriterTimeout        *int
+	shadowWriterMaxInFlight    *int
+	writerURIsByType           *[]string
 }
 
 func createServiceConfiguration(app *cli.Cli) *serviceConfig {
@@ -51,10 +86,17 @@ func createServiceConfiguration(app *cli.Cli) *serviceConfig {
 		EnvVar: "UNFOLDING_WHITELIST",
 	})
 
+	unfoldingPoliciesFile := app.String(cli.StringOpt{
+		Name:   "unfolding-policies-file",
+		Value:  "",
+		Desc:   "JSON file with the unfolding policy of each collection type. When set, it replaces the unfolding whitelist",
+		EnvVar: "UNFOLDING_POLICIES_FILE",
+	})
+
 	writerURI := app.String(cli.StringOpt{
 		Name:   "writer-uri",
 		Value:  "http://localhost:8080/__content-collection-rw-neo4j/content-collection/",
-		Desc:   "URI of the Writer",
+		Desc:   "URI of the Writer. The collection type and uuid are appended to it, unless it is a template with {collectionType} and {uuid} placeholders",
 		EnvVar: "WRITER_URI",
 	})
 
@@ -127,11 +169,250 @@ func createServiceConfiguration(app *cli.Cli) *serviceConfig {
 		EnvVar: "REQUEST_TIMEOUT",
 	})
 
+	asyncUnfolding := app.Bool(cli.BoolOpt{
+		Name:   "async-unfolding",
+		Value:  false,
+		Desc:   "Respond with 202 as soon as the writer succeeded and unfold the collection in the background",
+		EnvVar: "ASYNC_UNFOLDING",
+	})
+
+	asyncWorkers := app.Int(cli.IntOpt{
+		Name:   "async-workers",
+		Value:  4,
+		Desc:   "Number of background workers unfolding collections when async unfolding is enabled",
+		EnvVar: "ASYNC_WORKERS",
+	})
+
+	asyncQueueSize := app.Int(cli.IntOpt{
+		Name:   "async-queue-size",
+		Value:  100,
+		Desc:   "Number of collections waiting to be unfolded in the background before falling back to synchronous unfolding",
+		EnvVar: "ASYNC_QUEUE_SIZE",
+	})
+
+	asyncDrainTimeout := app.Int(cli.IntOpt{
+		Name:   "async-drain-timeout",
+		Value:  20,
+		Desc:   "Seconds to wait on shutdown for the queued collections to be unfolded, and for the replays to the shadow writer",
+		EnvVar: "ASYNC_DRAIN_TIMEOUT",
+	})
+
+	sendFailurePolicy := app.String(cli.StringOpt{
+		Name:   "send-failure-policy",
+		Value:  "report",
+		Desc:   "What to answer when some kafka messages could not be sent: report (200 with the report), multi-status (207) or fail (503, needs --outbox-dir to retry the failed messages)",
+		EnvVar: "SEND_FAILURE_POLICY",
+	})
+
+	idempotencyStore := app.String(cli.StringOpt{
+		Name:   "idempotency-store",
+		Value:  "none",
+		Desc:   "Where to remember processed publishes, so that retries of a publish are not notified again: none, memory or file",
+		EnvVar: "IDEMPOTENCY_STORE",
+	})
+
+	idempotencyFile := app.String(cli.StringOpt{
+		Name:   "idempotency-file",
+		Value:  "processed-publishes.json",
+		Desc:   "File of the file idempotency store",
+		EnvVar: "IDEMPOTENCY_FILE",
+	})
+
+	idempotencyCapacity := app.Int(cli.IntOpt{
+		Name:   "idempotency-capacity",
+		Value:  10000,
+		Desc:   "Number of processed publishes to remember",
+		EnvVar: "IDEMPOTENCY_CAPACITY",
+	})
+
+	idempotencyTTL := app.Int(cli.IntOpt{
+		Name:   "idempotency-ttl",
+		Value:  3600,
+		Desc:   "Seconds to remember a processed publish for",
+		EnvVar: "IDEMPOTENCY_TTL",
+	})
+
+	collectionLockTimeout := app.Int(cli.IntOpt{
+		Name:   "collection-lock-timeout",
+		Value:  10,
+		Desc:   "Seconds an update waits for the previous update of the same collection to finish before answering with 503. Updates are only serialized within one instance",
+		EnvVar: "COLLECTION_LOCK_TIMEOUT",
+	})
+
+	freshnessCapacity := app.Int(cli.IntOpt{
+		Name:   "freshness-capacity",
+		Value:  10000,
+		Desc:   "Number of collections whose last accepted lastModified is remembered, to reject stale updates",
+		EnvVar: "FRESHNESS_CAPACITY",
+	})
+
+	freshnessTTL := app.Int(cli.IntOpt{
+		Name:   "freshness-ttl",
+		Value:  86400,
+		Desc:   "Seconds to remember the last accepted lastModified of a collection for",
+		EnvVar: "FRESHNESS_TTL",
+	})
+
+	outboxDir := app.String(cli.StringOpt{
+		Name:   "outbox-dir",
+		Value:  "",
+		Desc:   "Directory where the notifications are kept until delivered. When empty, failed notifications are not retried",
+		EnvVar: "OUTBOX_DIR",
+	})
+
+	outboxRetryInterval := app.Int(cli.IntOpt{
+		Name:   "outbox-retry-interval",
+		Value:  30,
+		Desc:   "Seconds to wait before retrying notifications from the outbox, doubled after every failed retry",
+		EnvVar: "OUTBOX_RETRY_INTERVAL",
+	})
+
+	outboxMaxAttempts := app.Int(cli.IntOpt{
+		Name:   "outbox-max-attempts",
+		Value:  10,
+		Desc:   "Number of attempts made at most to deliver the notifications of an update before they are moved to the dead letters of the outbox. 0 means no limit",
+		EnvVar: "OUTBOX_MAX_ATTEMPTS",
+	})
+
+	batchConcurrency := app.Int(cli.IntOpt{
+		Name:   "batch-concurrency",
+		Value:  defaultBatchConcurrency,
+		Desc:   "Number of collections of a batch processed at the same time",
+		EnvVar: "BATCH_CONCURRENCY",
+	})
+
+	batchMaxLines := app.Int(cli.IntOpt{
+		Name:   "batch-max-lines",
+		Value:  defaultBatchMaxLines,
+		Desc:   "Maximum number of collections in a batch, the rest of larger batches is refused with 413",
+		EnvVar: "BATCH_MAX_LINES",
+	})
+
+	batchMaxBytes := app.Int(cli.IntOpt{
+		Name:   "batch-max-bytes",
+		Value:  defaultBatchMaxBytes,
+		Desc:   "Maximum size of a batch in bytes, the rest of larger batches is refused with 413",
+		EnvVar: "BATCH_MAX_BYTES",
+	})
+
+	requestDeadline := app.Int(cli.IntOpt{
+		Name:   "request-deadline",
+		Value:  0,
+		Desc:   "Seconds a request may spend calling the writer, relations-api, the document-store-api and kafka before answering with 504. 0 means no deadline",
+		EnvVar: "REQUEST_DEADLINE",
+	})
+
+	collectionSchemasDir := app.String(cli.StringOpt{
+		Name:   "collection-schemas-dir",
+		Value:  "",
+		Desc:   "Directory with the JSON schemas of collection types, one file per type like content-package.json. Other types use the bundled schema",
+		EnvVar: "COLLECTION_SCHEMAS_DIR",
+	})
+
+	maxCollectionItems := app.Int(cli.IntOpt{
+		Name:   "max-collection-items",
+		Value:  0,
+		Desc:   "Collections with more items are answered with 400. 0 means no limit",
+		EnvVar: "MAX_COLLECTION_ITEMS",
+	})
+
+	writerRetryMaxAttempts := app.Int(cli.IntOpt{
+		Name:   "writer-retry-max-attempts",
+		Value:  1,
+		Desc:   "Number of calls made at most to the writer for one PUT or DELETE, the first one included. 1 means no retry",
+		EnvVar: "WRITER_RETRY_MAX_ATTEMPTS",
+	})
+
+	writerRetryBaseDelay := app.Int(cli.IntOpt{
+		Name:   "writer-retry-base-delay",
+		Value:  200,
+		Desc:   "Milliseconds to wait before the first retry of a writer call, doubled before every other retry",
+		EnvVar: "WRITER_RETRY_BASE_DELAY",
+	})
+
+	writerRetryJitter := app.Int(cli.IntOpt{
+		Name:   "writer-retry-jitter",
+		Value:  100,
+		Desc:   "Milliseconds added at most, at random, to every wait before a retry of a writer call",
+		EnvVar: "WRITER_RETRY_JITTER",
+	})
+
+	writerRetryStatuses := app.Ints(cli.IntsOpt{
+		Name:   "writer-retry-statuses",
+		Value:  []int{502, 503, 504},
+		Desc:   "Writer responses that are retried, besides transport errors",
+		EnvVar: "WRITER_RETRY_STATUSES",
+	})
+
+	breakerFailureThreshold := app.Int(cli.IntOpt{
+		Name:   "breaker-failure-threshold",
+		Value:  5,
+		Desc:   "Consecutive failed calls to the writer, relations-api or the document-store-api after which the calls to it fail fast with 503. 0 disables the circuit breakers",
+		EnvVar: "BREAKER_FAILURE_THRESHOLD",
+	})
+
+	breakerOpenTimeout := app.Int(cli.IntOpt{
+		Name:   "breaker-open-timeout",
+		Value:  30,
+		Desc:   "Seconds an open circuit breaker fails the calls before letting a probe call through",
+		EnvVar: "BREAKER_OPEN_TIMEOUT",
+	})
+
+	breakerHalfOpenProbes := app.Int(cli.IntOpt{
+		Name:   "breaker-half-open-probes",
+		Value:  1,
+		Desc:   "Consecutive successful probe calls that close a circuit breaker again",
+		EnvVar: "BREAKER_HALF_OPEN_PROBES",
+	})
+
+	extraWriterURIs := app.Strings(cli.StringsOpt{
+		Name:   "extra-writer-uris",
+		Value:  []string{},
+		Desc:   "Further writers every collection is written to, each as required=<uri> or best-effort=<uri>. Unfolding needs all the required writers to succeed",
+		EnvVar: "EXTRA_WRITER_URIS",
+	})
+
+	writerAggregation := app.String(cli.StringOpt{
+		Name:   "writer-aggregation",
+		Value:  "primary",
+		Desc:   "Which response is returned when writing to several writers: primary (the one of the first failed required writer, or of --writer-uri) or summary (the status of every writer)",
+		EnvVar: "WRITER_AGGREGATION",
+	})
+
+	shadowWriterURI := app.String(cli.StringOpt{
+		Name:   "shadow-writer-uri",
+		Value:  "",
+		Desc:   "Candidate writer every PUT to --writer-uri is replayed to in the background, comparing the responses. Its responses never reach the client. When empty, nothing is replayed",
+		EnvVar: "SHADOW_WRITER_URI",
+	})
+
+	shadowWriterTimeout := app.Int(cli.IntOpt{
+		Name:   "shadow-writer-timeout",
+		Value:  10,
+		Desc:   "Seconds a replay to the shadow writer may take, above 0",
+		EnvVar: "SHADOW_WRITER_TIMEOUT",
+	})
+
+	shadowWriterMaxInFlight := app.Int(cli.IntOpt{
+		Name:   "shadow-writer-max-in-flight",
+		Value:  20,
+		Desc:   "Number of replays to the shadow writer running at the same time, above which PUTs are not replayed",
+		EnvVar: "SHADOW_WRITER_MAX_IN_FLIGHT",
+	})
+
+	writerURIsByType := app.Strings(cli.StringsOpt{
+		Name:   "writer-uris-by-type",
+		Value:  []string{},
+		Desc:   "Writers of the collection types that do not go to --writer-uri, each as <collectionType>=<uri>. The URIs may be templates like --writer-uri",
+		EnvVar: "WRITER_URIS_BY_TYPE",
+	})
+
 	return &serviceConfig{
 		appSystemCode:              appSystemCode,
 		appName:                    appName,
 		appPort:                    appPort,
 		unfoldingWhitelist:         unfoldingWhitelist,
+		unfoldingPoliciesFile:      unfoldingPoliciesFile,
 		writerURI:                  writerURI,
 		writerHealthURI:            writerHealthURI,
 		contentResolverURI:         contentResolverURI,
@@ -143,6 +424,40 @@ func createServiceConfiguration(app *cli.Cli) *serviceConfig {
 		kafkaHostname:              kafkaHostname,
 		kafkaAuth:                  kafkaAuth,
 		requestTimeout:             requestTimeout,
+		asyncUnfolding:             asyncUnfolding,
+		asyncWorkers:               asyncWorkers,
+		asyncQueueSize:             asyncQueueSize,
+		asyncDrainTimeout:          asyncDrainTimeout,
+		sendFailurePolicy:          sendFailurePolicy,
+		idempotencyStore:           idempotencyStore,
+		idempotencyFile:            idempotencyFile,
+		idempotencyCapacity:        idempotencyCapacity,
+		idempotencyTTL:             idempotencyTTL,
+		collectionLockTimeout:      collectionLockTimeout,
+		freshnessCapacity:          freshnessCapacity,
+		freshnessTTL:               freshnessTTL,
+		outboxDir:                  outboxDir,
+		outboxRetryInterval:        outboxRetryInterval,
+		outboxMaxAttempts:          outboxMaxAttempts,
+		batchConcurrency:           batchConcurrency,
+		batchMaxLines:              batchMaxLines,
+		batchMaxBytes:              batchMaxBytes,
+		requestDeadline:            requestDeadline,
+		collectionSchemasDir:       collectionSchemasDir,
+		maxCollectionItems:         maxCollectionItems,
+		writerRetryMaxAttempts:     writerRetryMaxAttempts,
+		writerRetryBaseDelay:       writerRetryBaseDelay,
+		writerRetryJitter:          writerRetryJitter,
+		writerRetryStatuses:        writerRetryStatuses,
+		breakerFailureThreshold:    breakerFailureThreshold,
+		breakerOpenTimeout:         breakerOpenTimeout,
+		breakerHalfOpenProbes:      breakerHalfOpenProbes,
+		extraWriterURIs:            extraWriterURIs,
+		writerAggregation:          writerAggregation,
+		shadowWriterURI:            shadowWriterURI,
+		shadowWriterTimeout:        shadowWriterTimeout,
+		shadowWriterMaxInFlight:    shadowWriterMaxInFlight,
+		writerURIsByType:           writerURIsByType,
 	}
 }
 
@@ -152,6 +467,7 @@ func (sc *serviceConfig) toMap() map[string]interface{} {
 		"appName":                    *sc.appName,
 		"appPort":                    *sc.appPort,
 		"unfoldingWhitelist":         *sc.unfoldingWhitelist,
+		"unfoldingPoliciesFile":      *sc.unfoldingPoliciesFile,
 		"writerURI":                  *sc.writerURI,
 		"writerHealthURI":            *sc.writerHealthURI,
 		"contentResolverURI":         *sc.contentResolverURI,
@@ -163,5 +479,39 @@ func (sc *serviceConfig) toMap() map[string]interface{} {
 		"kafkaHostname":              *sc.kafkaHostname,
 		"kafkaAuth":                  *sc.kafkaAuth,
 		"requestTimeout":             *sc.requestTimeout,
+		"asyncUnfolding":             *sc.asyncUnfolding,
+		"asyncWorkers":               *sc.asyncWorkers,
+		"asyncQueueSize":             *sc.asyncQueueSize,
+		"asyncDrainTimeout":          *sc.asyncDrainTimeout,
+		"sendFailurePolicy":          *sc.sendFailurePolicy,
+		"idempotencyStore":           *sc.idempotencyStore,
+		"idempotencyFile":            *sc.idempotencyFile,
+		"idempotencyCapacity":        *sc.idempotencyCapacity,
+		"idempotencyTTL":             *sc.idempotencyTTL,
+		"collectionLockTimeout":      *sc.collectionLockTimeout,
+		"freshnessCapacity":          *sc.freshnessCapacity,
+		"freshnessTTL":               *sc.freshnessTTL,
+		"outboxDir":                  *sc.outboxDir,
+		"outboxRetryInterval":        *sc.outboxRetryInterval,
+		"outboxMaxAttempts":          *sc.outboxMaxAttempts,
+		"batchConcurrency":           *sc.batchConcurrency,
+		"batchMaxLines":              *sc.batchMaxLines,
+		"batchMaxBytes":              *sc.batchMaxBytes,
+		"requestDeadline":            *sc.requestDeadline,
+		"collectionSchemasDir":       *sc.collectionSchemasDir,
+		"maxCollectionItems":         *sc.maxCollectionItems,
+		"writerRetryMaxAttempts":     *sc.writerRetryMaxAttempts,
+		"writerRetryBaseDelay":       *sc.writerRetryBaseDelay,
+		"writerRetryJitter":          *sc.writerRetryJitter,
+		"writerRetryStatuses":        *sc.writerRetryStatuses,
+		"breakerFailureThreshold":    *sc.breakerFailureThreshold,
+		"breakerOpenTimeout":         *sc.breakerOpenTimeout,
+		"breakerHalfOpenProbes":      *sc.breakerHalfOpenProbes,
+		"extraWriterURIs":            *sc.extraWriterURIs,
+		"writerAggregation":          *sc.writerAggregation,
+		"shadowWriterURI":            *sc.shadowWriterURI,
+		"shadowWriterTimeout":        *sc.shadowWriterTimeout,
+		"shadowWriterMaxInFlight":    *sc.shadowWriterMaxInFlight,
+		"writerURIsByType":           *sc.writerURIsByType,
 	}
 }
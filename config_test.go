@@ -23,6 +23,7 @@ func TestDefaults(t *testing.T) {
 		assert.NotEmpty(t, configMap["appName"])
 		assert.NotEmpty(t, configMap["appPort"])
 		assert.NotEmpty(t, configMap["unfoldingWhitelist"])
+		assert.Equal(t, emptyString, configMap["unfoldingPoliciesFile"])
 		assert.NotEmpty(t, configMap["writerURI"])
 		assert.NotEmpty(t, configMap["writerHealthURI"])
 		assert.NotEmpty(t, configMap["contentResolverURI"])
@@ -34,6 +35,40 @@ func TestDefaults(t *testing.T) {
 		assert.NotEmpty(t, configMap["kafkaHostname"])
 		assert.Equal(t, emptyString, configMap["kafkaAuth"])
 		assert.Equal(t, requestTimeoutSeconds, configMap["requestTimeout"])
+		assert.Equal(t, false, configMap["asyncUnfolding"])
+		assert.Equal(t, 4, configMap["asyncWorkers"])
+		assert.Equal(t, 100, configMap["asyncQueueSize"])
+		assert.Equal(t, 20, configMap["asyncDrainTimeout"])
+		assert.Equal(t, "report", configMap["sendFailurePolicy"])
+		assert.Equal(t, "none", configMap["idempotencyStore"])
+		assert.Equal(t, "processed-publishes.json", configMap["idempotencyFile"])
+		assert.Equal(t, 10000, configMap["idempotencyCapacity"])
+		assert.Equal(t, 3600, configMap["idempotencyTTL"])
+		assert.Equal(t, 10, configMap["collectionLockTimeout"])
+		assert.Equal(t, 10000, configMap["freshnessCapacity"])
+		assert.Equal(t, 86400, configMap["freshnessTTL"])
+		assert.Equal(t, emptyString, configMap["outboxDir"])
+		assert.Equal(t, 30, configMap["outboxRetryInterval"])
+		assert.Equal(t, 10, configMap["outboxMaxAttempts"])
+		assert.Equal(t, 4, configMap["batchConcurrency"])
+		assert.Equal(t, 1000, configMap["batchMaxLines"])
+		assert.Equal(t, 104857600, configMap["batchMaxBytes"])
+		assert.Equal(t, 0, configMap["requestDeadline"])
+		assert.Equal(t, emptyString, configMap["collectionSchemasDir"])
+		assert.Equal(t, 0, configMap["maxCollectionItems"])
+		assert.Equal(t, 1, configMap["writerRetryMaxAttempts"])
+		assert.Equal(t, 200, configMap["writerRetryBaseDelay"])
+		assert.Equal(t, 100, configMap["writerRetryJitter"])
+		assert.Equal(t, []int{502, 503, 504}, configMap["writerRetryStatuses"])
+		assert.Equal(t, 5, configMap["breakerFailureThreshold"])
+		assert.Equal(t, 30, configMap["breakerOpenTimeout"])
+		assert.Equal(t, 1, configMap["breakerHalfOpenProbes"])
+		assert.Equal(t, []string{}, configMap["extraWriterURIs"])
+		assert.Equal(t, "primary", configMap["writerAggregation"])
+		assert.Equal(t, "", configMap["shadowWriterURI"])
+		assert.Equal(t, 10, configMap["shadowWriterTimeout"])
+		assert.Equal(t, 20, configMap["shadowWriterMaxInFlight"])
+		assert.Equal(t, []string{}, configMap["writerURIsByType"])
 	}
 
 	app.Run([]string{"content-collection-unfolder"})
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+
+	"github.com/Financial-Times/content-collection-unfolder/policy"
+	logger "github.com/Financial-Times/go-logger"
+)
+
+// containerChain returns the containers of the collection the policy asks to notify, starting from its lead article
+// and walking up through the containers of each one, at most containerDepth levels. The containers are notified only
+// when the membership of the collection changed, so they are not republished by no-op updates.
+func (u *unfolder) containerChain(ctx context.Context, tid string, uuid string, collectionType string, leadArticle string, membershipChanged bool, unfoldingPolicy policy.Policy) []string {
+	depth := containerDepth(unfoldingPolicy)
+	if depth == 0 || leadArticle == "" {
+		return nil
+	}
+
+	if !membershipChanged {
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip notifying the containers. Membership did not change", tid, uuid, collectionType)
+		return nil
+	}
+
+	chain := []string{leadArticle}
+	visited := map[string]bool{uuid: true, leadArticle: true}
+	for container := leadArticle; len(chain) < depth; {
+		relations, err := u.relationsResolver.ResolveContext(ctx, container, tid)
+		if err != nil {
+			logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Notifying only [%v] levels of containers. Error while resolving the container of [%v]: %v", tid, uuid, collectionType, len(chain), container, err)
+			break
+		}
+
+		container = relations.ContainedIn
+		if container == "" || visited[container] {
+			break
+		}
+		visited[container] = true
+		chain = append(chain, container)
+	}
+	return chain
+}
+
+// containerDepth tells how many levels of containers are notified. Including the lead article is the first level.
+func containerDepth(unfoldingPolicy policy.Policy) int {
+	if unfoldingPolicy.ContainerDepth > 0 {
+		return unfoldingPolicy.ContainerDepth
+	}
+	if unfoldingPolicy.IncludeLeadArticle {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	"github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func expectContainers(mrr *mockRelationsResolver, containers map[string]string) {
+	for uuid, containedIn := range containers {
+		mrr.On("Resolve", uuid, nestedTid).Return(&relations.CCRelations{ContainedIn: containedIn}, nil)
+	}
+}
+
+func TestContainerChain(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+	expectContainers(mrr, map[string]string{
+		"lead":    "package",
+		"package": "page",
+		// the page is contained in the lead article again
+		"page": "lead",
+	})
+
+	chain := u.containerChain(context.Background(), nestedTid, "collection", whitelistedCollection, "lead", true, policy.Policy{ContainerDepth: 3})
+	assert.Equal(t, []string{"lead", "package", "page"}, chain)
+
+	chain = u.containerChain(context.Background(), nestedTid, "collection", whitelistedCollection, "lead", true, policy.Policy{ContainerDepth: 10})
+	assert.Equal(t, []string{"lead", "package", "page"}, chain)
+
+	chain = u.containerChain(context.Background(), nestedTid, "collection", whitelistedCollection, "lead", true, policy.Policy{IncludeLeadArticle: true})
+	assert.Equal(t, []string{"lead"}, chain)
+}
+
+func TestContainerChainOnlyWhenMembershipChanged(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+
+	chain := u.containerChain(context.Background(), nestedTid, "collection", whitelistedCollection, "lead", false, policy.Policy{IncludeLeadArticle: true, ContainerDepth: 3})
+	assert.Empty(t, chain)
+
+	chain = u.containerChain(context.Background(), nestedTid, "collection", whitelistedCollection, "lead", true, policy.Policy{})
+	assert.Empty(t, chain)
+
+	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
+}
+
+func TestContainerChainStopsOnRelationsError(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+	mrr.On("Resolve", "lead", nestedTid).Return(&relations.CCRelations{ContainedIn: "package"}, nil)
+	mrr.On("Resolve", "package", nestedTid).Return(&relations.CCRelations{}, errors.New("relations resolver error"))
+
+	chain := u.containerChain(context.Background(), nestedTid, "collection", whitelistedCollection, "lead", true, policy.Policy{ContainerDepth: 3})
+	assert.Equal(t, []string{"lead", "package"}, chain)
+}
+
+func TestNoopUpdateSkipsLeadArticle(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.policies = policy.NewPolicies(map[string]policy.Policy{
+		whitelistedCollection: {Unfold: true, IncludeLeadArticle: true},
+	})
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid},
+		LastModified: lastModified,
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", collectionUuid, tid).
+		Return(&relations.CCRelations{Contains: []string{firstExistingItemUuid}, ContainedIn: leadArticleUuid}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(differ.CollectionDiff{Unchanged: []string{firstExistingItemUuid}})
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
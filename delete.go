@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	res "github.com/Financial-Times/content-collection-unfolder/resolver"
+	logger "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/transactionid-utils-go"
+)
+
+// handleDelete deletes the collection through the writer and notifies the content that used to be in it.
+func (u *unfolder) handleDelete(writer http.ResponseWriter, req *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	uuid, collectionType := extractPathVariables(req)
+
+	writer.Header().Add(transactionidutils.TransactionIDHeader, tid)
+	writer.Header().Add("Content-Type", "application/json;charset=utf-8")
+
+	if err := validateCollectionUuid(tid, uuid, collectionType); err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := u.withDeadline(req.Context())
+	defer cancel()
+
+	lock, err := u.lockCollection(tid, uuid, collectionType)
+	if err != nil {
+		writeError(writer, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer lock.release()
+
+	oldCollectionRelations, err := u.relationsResolver.ResolveContext(ctx, uuid, tid)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while fetching old collection relations: %v", tid, uuid, collectionType, err)
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	fwResp, err := u.forwarder.DeleteContext(ctx, tid, uuid, collectionType)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error during forwarding of delete: %v", tid, uuid, collectionType, err)
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	if fwResp.Status != http.StatusOK && fwResp.Status != http.StatusNoContent {
+		logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. Writer returned status [%v]", tid, uuid, collectionType, fwResp.Status)
+		writeResponse(writer, fwResp.Status, fwResp.ResponseBody)
+		return
+	}
+	u.freshness.forget(uuid)
+	if u.publishes != nil {
+		u.publishes.Forget(uuid)
+	}
+
+	unfoldingPolicy := u.policies.For(collectionType)
+	if !unfoldingPolicy.Unfold {
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. Collection type [%v] is not unfolded by policy", tid, uuid, collectionType, collectionType)
+		writeResponse(writer, fwResp.Status, fwResp.ResponseBody)
+		return
+	}
+
+	formerMembers := append([]string{}, oldCollectionRelations.Contains...)
+	changesByUuid := changeTypes(differ.CollectionDiff{Removed: oldCollectionRelations.Contains})
+	if unfoldingPolicy.NestedDepth > 0 {
+		nested, err := u.nestedChanges(ctx, tid, uuid, nil, oldCollectionRelations.Contains, unfoldingPolicy.NestedDepth)
+		if err != nil {
+			logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unfolding only the direct members. Error while resolving nested collections: %v", tid, uuid, collectionType, err)
+		}
+		for _, nestedUuid := range sortedKeys(nested) {
+			formerMembers = append(formerMembers, nestedUuid)
+			changesByUuid[nestedUuid] = nested[nestedUuid]
+		}
+	}
+	// the lead article of a deleted collection is always notified, its own containers only as the policy says
+	containers := u.containerChain(ctx, tid, uuid, collectionType, oldCollectionRelations.ContainedIn, true, unfoldingPolicy)
+	if len(containers) == 0 && oldCollectionRelations.ContainedIn != "" {
+		containers = []string{oldCollectionRelations.ContainedIn}
+	}
+	formerMembers = append(formerMembers, containers...)
+
+	if len(formerMembers) == 0 {
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. Deleted collection had no members and no lead article.", tid, uuid, collectionType)
+		writeResponse(writer, fwResp.Status, fwResp.ResponseBody)
+		return
+	}
+
+	job := unfoldingJob{
+		tid:            tid,
+		uuid:           uuid,
+		collectionType: collectionType,
+		lastModified:   time.Now().UTC().Format(res.DateTimeFormat),
+		diffUuids:      formerMembers,
+		options:        messageOptions(unfoldingPolicy, changesByUuid),
+		release:        lock.share(),
+	}
+
+	result, queued, err := u.unfoldOrQueue(ctx, job)
+	if err != nil {
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	if queued {
+		writeResponse(writer, http.StatusAccepted, fwResp.ResponseBody)
+		return
+	}
+
+	if result.sendErr != nil && u.sendFailureStatus != http.StatusOK {
+		report := newDeleteReport(fwResp.Status, oldCollectionRelations)
+		report.Unfolding = unfoldingDone
+		report.addResult(result)
+		writeReport(writer, u.sendFailureStatus, report)
+		return
+	}
+
+	writeResponse(writer, fwResp.Status, fwResp.ResponseBody)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/idempotency"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDelete_AllOk(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	oldRelations := relations.CCRelations{
+		ContainedIn: leadArticleUuid,
+		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid},
+	}
+	contentArr := []map[string]interface{}{
+		{"uuid": firstExistingItemUuid},
+		{"uuid": secondExistingItemUuid},
+		{"uuid": leadArticleUuid},
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildDeleteRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+	u.freshness.accept(collectionUuid, lastModified)
+	u.enableIdempotency(idempotency.NewMemoryStore(10, time.Minute))
+	publish := idempotency.Key{CollectionUUID: collectionUuid, PublishReference: "tid_publish", LastModified: lastModified}
+	u.publishes.Put(publish, idempotency.Outcome{Status: http.StatusOK, Body: []byte(`{"unfolding":"done"}`)})
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&oldRelations, nil)
+	mf.On("Delete",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, whitelistedCollection))).
+		Return(forwarder.ForwarderResponse{Status: http.StatusNoContent}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(expectStringSlice(t, []string{firstExistingItemUuid, secondExistingItemUuid, leadArticleUuid})),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(func(actual string) bool {
+			_, err := time.Parse(resolver.DateTimeFormat, actual)
+			assert.NoError(t, err)
+			return true
+		}),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: map[string]string{
+			firstExistingItemUuid:  prod.ChangeRemoved,
+			secondExistingItemUuid: prod.ChangeRemoved,
+		}}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusNoContent, tid, resp)
+	assert.Zero(t, u.freshness.accepted.Len(), "the deleted collection must be forgotten")
+	_, found := u.publishes.Get(publish)
+	assert.False(t, found, "a publish of the deleted collection must not be replayed")
+
+	mock.AssertExpectationsForObjects(t, mrr, mf, mcr, mcp)
+}
+
+func TestDelete_EmptyCollectionNotifiesLeadArticle(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.policies = policy.NewPolicies(map[string]policy.Policy{whitelistedCollection: {Unfold: true}})
+
+	oldRelations := relations.CCRelations{ContainedIn: leadArticleUuid}
+	contentArr := []map[string]interface{}{{"uuid": leadArticleUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildDeleteRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+
+	mrr.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.Anything).Return(&oldRelations, nil)
+	mf.On("Delete", mock.Anything, mock.Anything, mock.Anything).Return(forwarder.ForwarderResponse{Status: http.StatusNoContent}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(expectStringSlice(t, []string{leadArticleUuid})),
+		mock.Anything,
+		mock.Anything).
+		Return(contentArr, nil)
+	mcp.On("Send", mock.Anything, mock.Anything, mock.MatchedBy(expectMap(t, contentArr)), mock.Anything).Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusNoContent, tid, resp)
+	mock.AssertExpectationsForObjects(t, mrr, mf, mcr, mcp)
+}
+
+func TestDelete_WriterNotFound(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildDeleteRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&relations.CCRelations{}, nil)
+	fwResp := forwarder.ForwarderResponse{Status: http.StatusNotFound, ResponseBody: []byte(errorJson)}
+	mf.On("Delete",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, whitelistedCollection))).
+		Return(fwResp, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusNotFound, tid, resp)
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, fwResp.ResponseBody, respBody)
+
+	mock.AssertExpectationsForObjects(t, mrr, mf)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDelete_RelationsResolverError(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildDeleteRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&relations.CCRelations{}, errors.New("relations resolver error"))
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusInternalServerError, tid, resp)
+
+	mrr.AssertExpectations(t)
+	mf.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDelete_NotWhitelistedCollectionType(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildDeleteRequest(t, server.URL, ignoredCollection, collectionUuid, tid)
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&relations.CCRelations{Contains: []string{firstExistingItemUuid}}, nil)
+	mf.On("Delete",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, ignoredCollection))).
+		Return(forwarder.ForwarderResponse{Status: http.StatusNoContent}, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusNoContent, tid, resp)
+
+	mock.AssertExpectationsForObjects(t, mrr, mf)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDelete_SendFailureReport(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+	assert.NoError(t, u.setSendFailurePolicy("multi-status"))
+
+	oldRelations := relations.CCRelations{Contains: []string{firstExistingItemUuid, secondExistingItemUuid}}
+	contentArr := []map[string]interface{}{
+		{"uuid": firstExistingItemUuid},
+		{"uuid": secondExistingItemUuid},
+	}
+	outcomes := []prod.SendOutcome{
+		{UUID: firstExistingItemUuid},
+		{UUID: secondExistingItemUuid, Err: errors.New("kafka error")},
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildDeleteRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&oldRelations, nil)
+	mf.On("Delete", mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusNoContent}, nil)
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).Return(contentArr, nil)
+	mcp.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(outcomes, &prod.SendError{Failed: outcomes[1:], Total: 2})
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusMultiStatus, tid, resp)
+
+	report := readReport(t, resp)
+	assert.Equal(t, http.StatusNoContent, report.WriterStatus)
+	assert.Equal(t, unfoldingDone, report.Unfolding)
+	assert.Equal(t, []string{firstExistingItemUuid, secondExistingItemUuid}, report.Removed)
+	assert.Equal(t, []string{firstExistingItemUuid}, report.Sent)
+	assert.Equal(t, []failedMessage{{UUID: secondExistingItemUuid, Reason: "kafka error"}}, report.Failed)
+
+	mock.AssertExpectationsForObjects(t, mrr, mf, mcr, mcp)
+}
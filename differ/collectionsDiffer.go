@@ -4,6 +4,35 @@ import "github.com/Workiva/go-datastructures/set"
 
 type CollectionsDiffer interface {
 	SymmetricDifference(incomingCollectionUuids []string, oldCollectionUuids []string) *set.Set
+	Diff(incomingCollectionUuids []string, oldCollectionUuids []string) CollectionDiff
+}
+
+// CollectionDiff classifies the members of a collection by what an update did to them.
+// Members that stayed in the collection are either Unchanged or Moved.
+type CollectionDiff struct {
+	Added     []string
+	Removed   []string
+	Unchanged []string
+	Moved     []Move
+}
+
+// Move records a member that stayed in the collection but changed position. Positions are zero-based.
+type Move struct {
+	UUID string `json:"uuid"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// Changed returns the members that were either added or removed.
+func (cd CollectionDiff) Changed() *set.Set {
+	changedSet := set.New()
+	for _, addedUuid := range cd.Added {
+		changedSet.Add(addedUuid)
+	}
+	for _, removedUuid := range cd.Removed {
+		changedSet.Add(removedUuid)
+	}
+	return changedSet
 }
 
 type defaultCollectionsDiffer struct {
@@ -14,23 +43,95 @@ func NewDefaultCollectionsDiffer() *defaultCollectionsDiffer {
 }
 
 func (dcd *defaultCollectionsDiffer) SymmetricDifference(incomingCollectionUuids []string, oldCollectionUuids []string) *set.Set {
-	symDiffSet := set.New()
+	return dcd.Diff(incomingCollectionUuids, oldCollectionUuids).Changed()
+}
+
+// Diff keeps the order of the collections: added, unchanged and moved members in incoming order, removed ones in old order.
+// Of the members that stayed, the longest run that kept its relative order is unchanged and the others moved,
+// so adding or removing a member does not move the ones after it.
+func (dcd *defaultCollectionsDiffer) Diff(incomingCollectionUuids []string, oldCollectionUuids []string) CollectionDiff {
+	diff := CollectionDiff{Added: []string{}, Removed: []string{}, Unchanged: []string{}, Moved: []Move{}}
+
+	oldPositions := positions(oldCollectionUuids)
+	incomingPositions := positions(incomingCollectionUuids)
 
-	relativeComplement(incomingCollectionUuids, oldCollectionUuids, symDiffSet)
-	relativeComplement(oldCollectionUuids, incomingCollectionUuids, symDiffSet)
+	var keptIncoming []string
+	for i, incomingUuid := range incomingCollectionUuids {
+		if incomingPositions[incomingUuid] != i {
+			continue
+		}
+		if _, ok := oldPositions[incomingUuid]; ok {
+			keptIncoming = append(keptIncoming, incomingUuid)
+		} else {
+			diff.Added = append(diff.Added, incomingUuid)
+		}
+	}
 
-	return symDiffSet
+	var keptOld []string
+	for i, oldUuid := range oldCollectionUuids {
+		if oldPositions[oldUuid] != i {
+			continue
+		}
+		if _, ok := incomingPositions[oldUuid]; ok {
+			keptOld = append(keptOld, oldUuid)
+		} else {
+			diff.Removed = append(diff.Removed, oldUuid)
+		}
+	}
+
+	inOrder := longestCommonSubsequence(keptOld, keptIncoming)
+	for _, keptUuid := range keptIncoming {
+		if inOrder.Exists(keptUuid) {
+			diff.Unchanged = append(diff.Unchanged, keptUuid)
+		} else {
+			diff.Moved = append(diff.Moved, Move{UUID: keptUuid, From: oldPositions[keptUuid], To: incomingPositions[keptUuid]})
+		}
+	}
+
+	return diff
 }
 
-func relativeComplement(firstCollection []string, secondCollection []string, aggregatingSet *set.Set) {
-	secondColSet := set.New()
-	for _, secondColUuid := range secondCollection {
-		secondColSet.Add(secondColUuid)
+// positions maps each UUID to the position of its first occurrence.
+func positions(uuids []string) map[string]int {
+	uuidPositions := make(map[string]int, len(uuids))
+	for i, uuid := range uuids {
+		if _, ok := uuidPositions[uuid]; !ok {
+			uuidPositions[uuid] = i
+		}
+	}
+	return uuidPositions
+}
+
+func longestCommonSubsequence(first []string, second []string) *set.Set {
+	lengths := make([][]int, len(first)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(second)+1)
+	}
+	for i := len(first) - 1; i >= 0; i-- {
+		for j := len(second) - 1; j >= 0; j-- {
+			switch {
+			case first[i] == second[j]:
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
 	}
 
-	for _, firstColUuid := range firstCollection {
-		if !secondColSet.Exists(firstColUuid) {
-			aggregatingSet.Add(firstColUuid)
+	subsequence := set.New()
+	for i, j := 0, 0; i < len(first) && j < len(second); {
+		switch {
+		case first[i] == second[j]:
+			subsequence.Add(first[i])
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
 		}
 	}
+	return subsequence
 }
@@ -73,3 +73,68 @@ func TestCollectionDiffer_Diff_EmptyCollections_Ok(t *testing.T) {
 
 	assert.Equal(t, expectedDiffSet, actualDiffCol)
 }
+
+func TestCollectionDiffer_TypedDiff_Ok(t *testing.T) {
+	collectionsDiffer := NewDefaultCollectionsDiffer()
+
+	incomingCol := []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf", "077f67ef-e827-49f8-8207-01c7720cbd53", "79b5a80e-96a7-4ac8-b168-5406910de419"}
+	oldCol := []string{"ef0d9b7f-c3e9-4692-9e62-1a38789af24a", "9e917253-10d2-46d8-ab3b-b510dc3a7abf"}
+	expectedDiff := CollectionDiff{
+		Added:     []string{"077f67ef-e827-49f8-8207-01c7720cbd53", "79b5a80e-96a7-4ac8-b168-5406910de419"},
+		Removed:   []string{"ef0d9b7f-c3e9-4692-9e62-1a38789af24a"},
+		Unchanged: []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf"},
+		Moved:     []Move{},
+	}
+
+	actualDiff := collectionsDiffer.Diff(incomingCol, oldCol)
+
+	assert.Equal(t, expectedDiff, actualDiff)
+}
+
+func TestCollectionDiffer_TypedDiff_DuplicatesAndEmptyCollections_Ok(t *testing.T) {
+	collectionsDiffer := NewDefaultCollectionsDiffer()
+
+	incomingCol := []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf", "9e917253-10d2-46d8-ab3b-b510dc3a7abf"}
+	expectedDiff := CollectionDiff{
+		Added:     []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf"},
+		Removed:   []string{},
+		Unchanged: []string{},
+		Moved:     []Move{},
+	}
+
+	assert.Equal(t, expectedDiff, collectionsDiffer.Diff(incomingCol, nil))
+	assert.Equal(t, CollectionDiff{Added: []string{}, Removed: []string{}, Unchanged: []string{}, Moved: []Move{}}, collectionsDiffer.Diff(nil, nil))
+}
+
+func TestCollectionDiffer_TypedDiff_LeadMovedToThirdPosition(t *testing.T) {
+	collectionsDiffer := NewDefaultCollectionsDiffer()
+
+	oldCol := []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf", "077f67ef-e827-49f8-8207-01c7720cbd53", "79b5a80e-96a7-4ac8-b168-5406910de419"}
+	incomingCol := []string{"077f67ef-e827-49f8-8207-01c7720cbd53", "79b5a80e-96a7-4ac8-b168-5406910de419", "9e917253-10d2-46d8-ab3b-b510dc3a7abf"}
+	expectedDiff := CollectionDiff{
+		Added:     []string{},
+		Removed:   []string{},
+		Unchanged: []string{"077f67ef-e827-49f8-8207-01c7720cbd53", "79b5a80e-96a7-4ac8-b168-5406910de419"},
+		Moved:     []Move{{UUID: "9e917253-10d2-46d8-ab3b-b510dc3a7abf", From: 0, To: 2}},
+	}
+
+	actualDiff := collectionsDiffer.Diff(incomingCol, oldCol)
+
+	assert.Equal(t, expectedDiff, actualDiff)
+	assert.Equal(t, int64(0), actualDiff.Changed().Len())
+}
+
+func TestCollectionDiffer_TypedDiff_InsertionDoesNotMoveFollowingMembers(t *testing.T) {
+	collectionsDiffer := NewDefaultCollectionsDiffer()
+
+	oldCol := []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf", "077f67ef-e827-49f8-8207-01c7720cbd53"}
+	incomingCol := []string{"ef0d9b7f-c3e9-4692-9e62-1a38789af24a", "9e917253-10d2-46d8-ab3b-b510dc3a7abf", "077f67ef-e827-49f8-8207-01c7720cbd53"}
+	expectedDiff := CollectionDiff{
+		Added:     []string{"ef0d9b7f-c3e9-4692-9e62-1a38789af24a"},
+		Removed:   []string{},
+		Unchanged: []string{"9e917253-10d2-46d8-ab3b-b510dc3a7abf", "077f67ef-e827-49f8-8207-01c7720cbd53"},
+		Moved:     []Move{},
+	}
+
+	assert.Equal(t, expectedDiff, collectionsDiffer.Diff(incomingCol, oldCol))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/outbox"
+	logger "github.com/Financial-Times/go-logger"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	maxOutboxBackoff   = 10 * time.Minute
+)
+
+// outboxDispatcher retries the notifications left in the outbox until they are delivered.
+type outboxDispatcher struct {
+	unfolder *unfolder
+	interval time.Duration
+	stopped  chan struct{}
+	done     chan struct{}
+}
+
+func newOutboxDispatcher(u *unfolder, interval time.Duration) *outboxDispatcher {
+	return &outboxDispatcher{
+		unfolder: u,
+		interval: interval,
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (d *outboxDispatcher) start() {
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stopped:
+				return
+			case now := <-ticker.C:
+				d.dispatchDue(now)
+			}
+		}
+	}()
+}
+
+// stop waits for the entries being dispatched. The ones left are retried after a restart.
+func (d *outboxDispatcher) stop() {
+	close(d.stopped)
+	<-d.done
+}
+
+func (d *outboxDispatcher) dispatchDue(now time.Time) {
+	for _, entry := range d.unfolder.outbox.Due(now) {
+		select {
+		case <-d.stopped:
+			return
+		default:
+		}
+
+		entry := entry
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Retrying %d notifications from the outbox. Attempt %d.", entry.Tid, entry.CollectionUUID, entry.CollectionType, len(entry.Uuids), entry.Attempts+1)
+		job := unfoldingJob{
+			tid:            entry.Tid,
+			uuid:           entry.CollectionUUID,
+			collectionType: entry.CollectionType,
+			lastModified:   entry.LastModified,
+			diffUuids:      entry.Uuids,
+			options:        entry.Options,
+			pending:        &entry,
+		}
+		// the outcome is recorded in the outbox by unfold
+		ctx, cancel := d.unfolder.withDeadline(context.Background())
+		_, _ = d.unfolder.unfold(ctx, job)
+		cancel()
+	}
+}
+
+// outboxBackoff doubles the wait after every failed attempt, up to maxOutboxBackoff.
+func outboxBackoff(retryInterval time.Duration, attempts int) time.Duration {
+	backoff := retryInterval
+	for i := 1; i < attempts && backoff < maxOutboxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxOutboxBackoff {
+		return maxOutboxBackoff
+	}
+	return backoff
+}
+
+// keepInOutbox stores the job in the outbox before it is attempted, so that its notifications are not lost if the
+// attempt fails or the service stops. The entry is in flight until the attempt settles, however long the job waits in
+// the async queue, so the dispatcher never delivers it at the same time. After a restart it is due once the retry
+// interval has passed.
+func (u *unfolder) keepInOutbox(job unfoldingJob) unfoldingJob {
+	if u.outbox == nil || job.pending != nil {
+		return job
+	}
+
+	entry, err := u.outbox.Add(outbox.Entry{
+		Tid:            job.tid,
+		CollectionUUID: job.uuid,
+		CollectionType: job.collectionType,
+		LastModified:   job.lastModified,
+		Uuids:          job.diffUuids,
+		Options:        job.options,
+		NextAttempt:    time.Now().Add(u.outboxRetryInterval),
+	})
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unable to store notifications in the outbox, they will not be retried: %v", job.tid, job.uuid, job.collectionType, err)
+		return job
+	}
+
+	job.pending = &entry
+	return job
+}
+
+// settleOutbox removes the job from the outbox once delivered, otherwise keeps the notifications still to deliver.
+// After the last of the allowed attempts they are moved to the dead letters instead. If that fails, they are kept with the
+// attempt counted, so that the move is tried again after the backoff rather than on every dispatch.
+func (u *unfolder) settleOutbox(job unfoldingJob, result unfoldingResult, err error) {
+	if job.pending == nil {
+		return
+	}
+
+	entry := *job.pending
+	if err == nil && result.sendErr == nil {
+		if err := u.outbox.Remove(entry.ID); err != nil {
+			logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unable to remove delivered notifications from the outbox: %v", job.tid, job.uuid, job.collectionType, err)
+		}
+		return
+	}
+
+	if err == nil {
+		entry.Uuids = []string{}
+		for _, outcome := range result.outcomes {
+			if outcome.Err != nil {
+				entry.Uuids = append(entry.Uuids, outcome.UUID)
+			}
+		}
+	}
+	entry.Attempts++
+	if u.outboxMaxAttempts > 0 && entry.Attempts >= u.outboxMaxAttempts {
+		err := u.outbox.DeadLetter(entry)
+		if err == nil {
+			logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Giving up on %d notifications after %d attempts. They were moved to the outbox dead letters.", job.tid, job.uuid, job.collectionType, len(entry.Uuids), entry.Attempts)
+			return
+		}
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unable to move undelivered notifications to the outbox dead letters: %v", job.tid, job.uuid, job.collectionType, err)
+	}
+	entry.NextAttempt = time.Now().Add(outboxBackoff(u.outboxRetryInterval, entry.Attempts))
+
+	if err := u.outbox.Save(entry); err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unable to update notifications in the outbox: %v", job.tid, job.uuid, job.collectionType, err)
+		return
+	}
+	logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v %d notifications kept in the outbox. Next attempt at %v.", job.tid, job.uuid, job.collectionType, len(entry.Uuids), entry.NextAttempt)
+}
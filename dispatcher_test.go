@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/outbox"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestOutbox(t *testing.T) (outbox.Outbox, func()) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+
+	o, err := outbox.NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	return o, func() { os.RemoveAll(dir) }
+}
+
+func TestOutbox_UndeliveredNotificationsAreRetried(t *testing.T) {
+	_, _, _, _, mcr, mcp, u := newUnfolderWithMocks()
+	o, cleanup := newTestOutbox(t)
+	defer cleanup()
+	u.outbox = o
+	u.outboxRetryInterval = time.Minute
+
+	job := unfoldingJob{
+		tid:            "tid_test",
+		uuid:           collectionUuid,
+		collectionType: whitelistedCollection,
+		lastModified:   lastModified,
+		diffUuids:      []string{addedItemUuid, deletedItemUuid},
+	}
+	contentArr := []map[string]interface{}{{"uuid": addedItemUuid}, {"uuid": deletedItemUuid}}
+	outcomes := []prod.SendOutcome{{UUID: addedItemUuid}, {UUID: deletedItemUuid, Err: errors.New("kafka error")}}
+
+	mcr.On("ResolveContentsNew", job.diffUuids, mock.Anything, mock.Anything).
+		Return(contentArr, nil).Once()
+	mcp.On("Send", mock.Anything, mock.Anything, contentArr, mock.Anything).
+		Return(outcomes, &prod.SendError{Failed: outcomes[1:], Total: 2}).Once()
+
+	_, queued, err := u.unfoldOrQueue(context.Background(), job)
+	assert.NoError(t, err)
+	assert.False(t, queued)
+
+	assert.Empty(t, o.Due(time.Now()))
+	pending := o.Due(time.Now().Add(time.Hour))
+	assert.Len(t, pending, 1)
+	assert.Equal(t, []string{deletedItemUuid}, pending[0].Uuids)
+	assert.Equal(t, 1, pending[0].Attempts)
+
+	retriedArr := []map[string]interface{}{{"uuid": deletedItemUuid}}
+	mcr.On("ResolveContentsNew", []string{deletedItemUuid}, mock.Anything, mock.Anything).
+		Return(retriedArr, nil).Once()
+	mcp.On("Send", mock.Anything, mock.Anything, retriedArr, mock.Anything).
+		Return(outcomesFor(retriedArr), nil).Once()
+
+	newOutboxDispatcher(u, time.Hour).dispatchDue(time.Now().Add(time.Hour))
+
+	assert.Empty(t, o.Due(time.Now().Add(24*time.Hour)))
+	mcp.AssertNumberOfCalls(t, "Send", 2)
+}
+
+func TestOutbox_ResolveFailureKeepsAllNotifications(t *testing.T) {
+	_, _, _, _, mcr, mcp, u := newUnfolderWithMocks()
+	o, cleanup := newTestOutbox(t)
+	defer cleanup()
+	u.outbox = o
+	u.outboxRetryInterval = time.Minute
+
+	job := unfoldingJob{tid: "tid_test", uuid: collectionUuid, diffUuids: []string{addedItemUuid, deletedItemUuid}}
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).
+		Return([]map[string]interface{}{}, errors.New("content resolver error"))
+
+	_, _, err := u.unfoldOrQueue(context.Background(), job)
+	assert.Error(t, err)
+
+	pending := o.Due(time.Now().Add(time.Hour))
+	assert.Len(t, pending, 1)
+	assert.Equal(t, job.diffUuids, pending[0].Uuids)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOutbox_QueuedJobIsNotDispatched(t *testing.T) {
+	_, _, _, _, mcr, mcp, u := newUnfolderWithMocks()
+	o, cleanup := newTestOutbox(t)
+	defer cleanup()
+	u.outbox = o
+	u.outboxRetryInterval = time.Minute
+
+	job := u.keepInOutbox(unfoldingJob{tid: "tid_test", uuid: collectionUuid, diffUuids: []string{addedItemUuid}})
+	assert.NotNil(t, job.pending)
+
+	// the job is still waiting in the async queue long after the retry interval
+	newOutboxDispatcher(u, time.Hour).dispatchDue(time.Now().Add(time.Hour))
+
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOutbox_DeadLetterAfterMaxAttempts(t *testing.T) {
+	_, _, _, _, mcr, mcp, u := newUnfolderWithMocks()
+	o, cleanup := newTestOutbox(t)
+	defer cleanup()
+	u.outbox = o
+	u.outboxRetryInterval = time.Minute
+	u.outboxMaxAttempts = 2
+
+	job := unfoldingJob{tid: "tid_test", uuid: collectionUuid, diffUuids: []string{addedItemUuid}}
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).
+		Return([]map[string]interface{}{}, errors.New("content resolver error"))
+
+	_, _, err := u.unfoldOrQueue(context.Background(), job)
+	assert.Error(t, err)
+	assert.Len(t, o.Due(time.Now().Add(time.Hour)), 1)
+
+	newOutboxDispatcher(u, time.Hour).dispatchDue(time.Now().Add(time.Hour))
+
+	assert.Empty(t, o.Due(time.Now().Add(24*time.Hour)))
+	mcr.AssertNumberOfCalls(t, "ResolveContentsNew", 2)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// failingDeadLetters is an outbox whose dead letters cannot be written.
+type failingDeadLetters struct {
+	outbox.Outbox
+}
+
+func (o failingDeadLetters) DeadLetter(entry outbox.Entry) error {
+	return errors.New("disk full")
+}
+
+func TestOutbox_FailedDeadLetterIsRetriedAfterBackoff(t *testing.T) {
+	_, _, _, _, mcr, mcp, u := newUnfolderWithMocks()
+	o, cleanup := newTestOutbox(t)
+	defer cleanup()
+	u.outbox = failingDeadLetters{Outbox: o}
+	u.outboxRetryInterval = time.Minute
+	u.outboxMaxAttempts = 1
+
+	job := unfoldingJob{tid: "tid_test", uuid: collectionUuid, diffUuids: []string{addedItemUuid}}
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).
+		Return([]map[string]interface{}{}, errors.New("content resolver error"))
+
+	_, _, err := u.unfoldOrQueue(context.Background(), job)
+	assert.Error(t, err)
+
+	assert.Empty(t, o.Due(time.Now()), "the entry must back off instead of being due again right away")
+	pending := o.Due(time.Now().Add(time.Hour))
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, outboxBackoff(30*time.Second, 1))
+	assert.Equal(t, 60*time.Second, outboxBackoff(30*time.Second, 2))
+	assert.Equal(t, 120*time.Second, outboxBackoff(30*time.Second, 3))
+	assert.Equal(t, maxOutboxBackoff, outboxBackoff(30*time.Second, 50))
+}
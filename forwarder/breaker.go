@@ -0,0 +1,49 @@
+package forwarder
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
+)
+
+type breakerForwarder struct {
+	next    Forwarder
+	breaker *breaker.Breaker
+}
+
+// NewBreakerForwarder makes the calls of next while the breaker lets them through. Each call counts once in the breaker,
+// whatever the number of attempts next makes, and fails when it gets no response or a 5xx one.
+func NewBreakerForwarder(next Forwarder, b *breaker.Breaker) Forwarder {
+	return &breakerForwarder{next: next, breaker: b}
+}
+
+func (f *breakerForwarder) Forward(tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return f.ForwardContext(context.Background(), tid, uuid, collectionType, reqBody)
+}
+
+func (f *breakerForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return f.call(ctx, func() (ForwarderResponse, error) {
+		return f.next.ForwardContext(ctx, tid, uuid, collectionType, reqBody)
+	})
+}
+
+func (f *breakerForwarder) Delete(tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return f.DeleteContext(context.Background(), tid, uuid, collectionType)
+}
+
+func (f *breakerForwarder) DeleteContext(ctx context.Context, tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return f.call(ctx, func() (ForwarderResponse, error) {
+		return f.next.DeleteContext(ctx, tid, uuid, collectionType)
+	})
+}
+
+func (f *breakerForwarder) call(ctx context.Context, call func() (ForwarderResponse, error)) (ForwarderResponse, error) {
+	var resp ForwarderResponse
+	err := f.breaker.Do(ctx, func() (bool, error) {
+		var err error
+		resp, err = call()
+		return err != nil || resp.Status >= http.StatusInternalServerError, err
+	})
+	return resp, err
+}
@@ -0,0 +1,48 @@
+package forwarder
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerCountsRetriedCallOnce(t *testing.T) {
+	mockServer, calls := flakyWriter(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer mockServer.Close()
+
+	b := breaker.New("test-writer", breaker.Settings{FailureThreshold: 2, OpenTimeout: time.Minute})
+	f := NewBreakerForwarder(NewForwarderWithRetry(http.DefaultClient, mockServer.URL, testRetryPolicy(2)), b)
+
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Status)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	assert.Equal(t, breaker.Closed, b.State(), "two failed attempts of one call are one failure")
+
+	_, err = f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	assert.Equal(t, breaker.Open, b.State())
+
+	_, err = f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.True(t, errors.Is(err, breaker.ErrOpen))
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+}
+
+func TestBreakerCountsSuccessfulRetry(t *testing.T) {
+	mockServer, calls := flakyWriter(t, http.StatusServiceUnavailable)
+	defer mockServer.Close()
+
+	b := breaker.New("test-writer", breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	f := NewBreakerForwarder(NewForwarderWithRetry(http.DefaultClient, mockServer.URL, testRetryPolicy(2)), b)
+
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	assert.Equal(t, breaker.Closed, b.State())
+}
@@ -0,0 +1,170 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	logger "github.com/Financial-Times/go-logger"
+)
+
+const (
+	// AggregatePrimary answers with the response of the first required target, as long as every required target
+	// succeeded. Otherwise the response of the first required target that did not succeed is returned.
+	AggregatePrimary = "primary"
+	// AggregateSummary answers with the status and error of every target, with the status of the first required
+	// target that did not succeed, or 200 if they all did.
+	AggregateSummary = "summary"
+)
+
+// Target is one of the writers a fan-out forwarder writes to.
+type Target struct {
+	Name      string
+	Forwarder Forwarder
+	// Required targets must succeed for the write to succeed. The failures of best-effort targets are only logged.
+	Required bool
+}
+
+type fanOutForwarder struct {
+	targets     []Target
+	aggregation string
+}
+
+type targetOutcome struct {
+	resp ForwarderResponse
+	err  error
+}
+
+type targetSummary struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	Status   int    `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewFanOutForwarder writes every collection to all the targets at the same time. The write succeeds when all the
+// required targets succeed, and the aggregation tells which response is returned: AggregatePrimary or AggregateSummary.
+// If a required target fails without responding, its error is returned whatever the aggregation.
+func NewFanOutForwarder(targets []Target, aggregation string) (Forwarder, error) {
+	if aggregation != AggregatePrimary && aggregation != AggregateSummary {
+		return nil, fmt.Errorf("unknown writer aggregation [%v]", aggregation)
+	}
+
+	hasRequired := false
+	for _, target := range targets {
+		hasRequired = hasRequired || target.Required
+	}
+	if !hasRequired {
+		return nil, fmt.Errorf("at least one of the [%d] writers must be required", len(targets))
+	}
+
+	return &fanOutForwarder{targets: targets, aggregation: aggregation}, nil
+}
+
+func (f *fanOutForwarder) Forward(tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return f.ForwardContext(context.Background(), tid, uuid, collectionType, reqBody)
+}
+
+func (f *fanOutForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	outcomes := f.fanOut(func(target Target) (ForwarderResponse, error) {
+		return target.Forwarder.ForwardContext(ctx, tid, uuid, collectionType, reqBody)
+	})
+	return f.aggregate(tid, http.MethodPut, outcomes)
+}
+
+func (f *fanOutForwarder) Delete(tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return f.DeleteContext(context.Background(), tid, uuid, collectionType)
+}
+
+func (f *fanOutForwarder) DeleteContext(ctx context.Context, tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	outcomes := f.fanOut(func(target Target) (ForwarderResponse, error) {
+		return target.Forwarder.DeleteContext(ctx, tid, uuid, collectionType)
+	})
+	return f.aggregate(tid, http.MethodDelete, outcomes)
+}
+
+// Drain waits for the calls in the background of the targets that make any, like the shadow forwarders.
+// The targets share the timeout.
+func (f *fanOutForwarder) Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	drained := true
+	for _, target := range f.targets {
+		if drainer, ok := target.Forwarder.(Drainer); ok {
+			drained = drainer.Drain(time.Until(deadline)) && drained
+		}
+	}
+	return drained
+}
+
+// fanOut calls every target at the same time and waits for all of them.
+func (f *fanOutForwarder) fanOut(call func(target Target) (ForwarderResponse, error)) []targetOutcome {
+	outcomes := make([]targetOutcome, len(f.targets))
+	var wg sync.WaitGroup
+	for i, target := range f.targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			resp, err := call(target)
+			outcomes[i] = targetOutcome{resp: resp, err: err}
+		}(i, target)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+func (f *fanOutForwarder) aggregate(tid string, method string, outcomes []targetOutcome) (ForwarderResponse, error) {
+	logEntry := logger.WithField("tid", tid)
+	primary, failed := -1, -1
+	summaries := make([]targetSummary, len(f.targets))
+	for i, target := range f.targets {
+		outcome := outcomes[i]
+		summaries[i] = targetSummary{Name: target.Name, Required: target.Required, Status: outcome.resp.Status}
+		if target.Required && primary < 0 {
+			primary = i
+		}
+		if outcome.err != nil {
+			summaries[i].Error = outcome.err.Error()
+		}
+		if outcome.err == nil && succeeded(method, outcome.resp.Status) {
+			continue
+		}
+
+		if !target.Required {
+			logEntry.Warnf("Best-effort writer [%v] failed on %v with status [%v]: %v", target.Name, method, outcome.resp.Status, outcome.err)
+			continue
+		}
+		logEntry.Warnf("Required writer [%v] failed on %v with status [%v]: %v", target.Name, method, outcome.resp.Status, outcome.err)
+		if failed < 0 {
+			failed = i
+		}
+	}
+
+	if failed >= 0 && outcomes[failed].err != nil {
+		return ForwarderResponse{}, fmt.Errorf("required writer [%v] failed: %w", f.targets[failed].Name, outcomes[failed].err)
+	}
+
+	if f.aggregation == AggregatePrimary {
+		if failed >= 0 {
+			return outcomes[failed].resp, nil
+		}
+		return outcomes[primary].resp, nil
+	}
+
+	status := http.StatusOK
+	if failed >= 0 {
+		status = outcomes[failed].resp.Status
+	}
+	body, err := json.Marshal(map[string]interface{}{"writers": summaries})
+	if err != nil {
+		return ForwarderResponse{}, err
+	}
+	return ForwarderResponse{Status: status, ResponseBody: body}, nil
+}
+
+// succeeded tells if the writer response lets the unfolding go on: 200 for a PUT, 200 or 204 for a DELETE.
+func succeeded(method string, status int) bool {
+	return status == http.StatusOK || (method == http.MethodDelete && status == http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubForwarder answers every call with the same response and error.
+type stubForwarder struct {
+	resp ForwarderResponse
+	err  error
+}
+
+func (s stubForwarder) Forward(tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return s.resp, s.err
+}
+
+func (s stubForwarder) Delete(tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return s.resp, s.err
+}
+
+func (s stubForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return s.resp, s.err
+}
+
+func (s stubForwarder) DeleteContext(ctx context.Context, tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return s.resp, s.err
+}
+
+func answering(status int, body string) Forwarder {
+	return stubForwarder{resp: ForwarderResponse{Status: status, ResponseBody: []byte(body)}}
+}
+
+func newTestFanOut(t *testing.T, aggregation string, targets ...Target) Forwarder {
+	f, err := NewFanOutForwarder(targets, aggregation)
+	assert.NoError(t, err)
+	return f
+}
+
+func TestFanOutAllRequiredSucceeded(t *testing.T) {
+	f := newTestFanOut(t, AggregatePrimary,
+		Target{Name: "best-effort", Forwarder: answering(http.StatusServiceUnavailable, "unavailable")},
+		Target{Name: "primary", Forwarder: answering(http.StatusOK, testRespBody), Required: true},
+		Target{Name: "secondary", Forwarder: answering(http.StatusOK, "secondary"), Required: true},
+	)
+
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, []byte(testRespBody), resp.ResponseBody)
+}
+
+func TestFanOutRequiredFailed(t *testing.T) {
+	f := newTestFanOut(t, AggregatePrimary,
+		Target{Name: "primary", Forwarder: answering(http.StatusOK, testRespBody), Required: true},
+		Target{Name: "secondary", Forwarder: answering(http.StatusBadRequest, "invalid"), Required: true},
+	)
+
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+	assert.Equal(t, []byte("invalid"), resp.ResponseBody)
+}
+
+func TestFanOutRequiredError(t *testing.T) {
+	f := newTestFanOut(t, AggregateSummary,
+		Target{Name: "primary", Forwarder: answering(http.StatusOK, testRespBody), Required: true},
+		Target{Name: "secondary", Forwarder: stubForwarder{err: errors.New("connection refused")}, Required: true},
+	)
+
+	_, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.EqualError(t, err, "required writer [secondary] failed: connection refused")
+}
+
+func TestFanOutSummary(t *testing.T) {
+	f := newTestFanOut(t, AggregateSummary,
+		Target{Name: "primary", Forwarder: answering(http.StatusNoContent, ""), Required: true},
+		Target{Name: "candidate", Forwarder: stubForwarder{err: errors.New("connection refused")}},
+	)
+
+	resp, err := f.Delete(testTid, testUuid, testCollection)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+
+	summary := map[string][]targetSummary{}
+	assert.NoError(t, json.Unmarshal(resp.ResponseBody, &summary))
+	assert.Equal(t, []targetSummary{
+		{Name: "primary", Required: true, Status: http.StatusNoContent},
+		{Name: "candidate", Error: "connection refused"},
+	}, summary["writers"])
+}
+
+func TestFanOutPutNeedsOk(t *testing.T) {
+	f := newTestFanOut(t, AggregateSummary,
+		Target{Name: "primary", Forwarder: answering(http.StatusNoContent, ""), Required: true},
+	)
+
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.Status)
+}
+
+func TestNewFanOutForwarderInvalid(t *testing.T) {
+	_, err := NewFanOutForwarder([]Target{{Name: "primary", Forwarder: answering(http.StatusOK, ""), Required: true}}, "fastest")
+	assert.Error(t, err)
+
+	_, err = NewFanOutForwarder([]Target{{Name: "candidate", Forwarder: answering(http.StatusOK, "")}}, AggregatePrimary)
+	assert.Error(t, err)
+}
@@ -2,16 +2,24 @@ package forwarder
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
+	logger "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/transactionid-utils-go"
 )
 
 type Forwarder interface {
 	Forward(tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error)
+	Delete(tid string, uuid string, collectionType string) (ForwarderResponse, error)
+	// ForwardContext and DeleteContext abort the call to the writer once ctx is done.
+	ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error)
+	DeleteContext(ctx context.Context, tid string, uuid string, collectionType string) (ForwarderResponse, error)
 }
 
 type ForwarderResponse struct {
@@ -19,28 +27,119 @@ type ForwarderResponse struct {
 	ResponseBody []byte
 }
 
+const (
+	uuidPlaceholder           = "{uuid}"
+	collectionTypePlaceholder = "{collectionType}"
+)
+
 type defaultForwarder struct {
 	client    *http.Client
 	writerUri string
+	uriByType map[string]string
+	retry     RetryPolicy
 }
 
 func NewForwarder(client *http.Client, writerUri string) Forwarder {
-	return &defaultForwarder{
+	return NewForwarderWithRetry(client, writerUri, NoRetry)
+}
+
+// NewForwarderWithRetry repeats the calls to the writer that fail with a transport error or a retryable status,
+// as the retry policy says.
+func NewForwarderWithRetry(client *http.Client, writerUri string, retry RetryPolicy) Forwarder {
+	return NewForwarderWithOverrides(client, writerUri, nil, retry)
+}
+
+// NewForwarderWithOverrides sends the collections of the types in uriByType to the writer URI given there,
+// and the others to writerUri. See ValidateWriterURI for the URIs accepted.
+func NewForwarderWithOverrides(client *http.Client, writerUri string, uriByType map[string]string, retry RetryPolicy) Forwarder {
+	f := defaultForwarder{
 		client:    client,
-		writerUri: strings.TrimSuffix(writerUri, "/"),
+		writerUri: writerUri,
+		uriByType: map[string]string{},
+		retry:     retry,
+	}
+	for collectionType, uri := range uriByType {
+		f.uriByType[collectionType] = uri
 	}
+	return &f
+}
+
+// ValidateWriterURI checks a writer URI. It is either a base URI the collection type and uuid are appended to,
+// or a template with a {uuid} and optionally a {collectionType} placeholder.
+func ValidateWriterURI(uri string) error {
+	if strings.Contains(uri, collectionTypePlaceholder) && !strings.Contains(uri, uuidPlaceholder) {
+		return fmt.Errorf("writer URI template [%v] has no %v placeholder", uri, uuidPlaceholder)
+	}
+	return nil
 }
 
 func (f *defaultForwarder) Forward(tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
-	req, err := http.NewRequest(http.MethodPut, f.buildUrl(collectionType, uuid), bytes.NewBuffer(reqBody))
+	return f.ForwardContext(context.Background(), tid, uuid, collectionType, reqBody)
+}
+
+func (f *defaultForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return f.do(ctx, tid, http.MethodPut, f.buildUrl(collectionType, uuid), reqBody)
+}
+
+func (f *defaultForwarder) Delete(tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return f.DeleteContext(context.Background(), tid, uuid, collectionType)
+}
+
+func (f *defaultForwarder) DeleteContext(ctx context.Context, tid string, uuid string, collectionType string) (ForwarderResponse, error) {
+	return f.do(ctx, tid, http.MethodDelete, f.buildUrl(collectionType, uuid), nil)
+}
+
+// do calls the writer until it answers with a status that is not retried, the attempts run out or ctx is done.
+// Every attempt is logged with its number, and the outcome of the last one is returned.
+func (f *defaultForwarder) do(ctx context.Context, tid string, method string, url string, reqBody []byte) (ForwarderResponse, error) {
+	logEntry := logger.WithField("tid", tid)
+	attempts := f.retry.attempts()
+	for attempt := 1; ; attempt++ {
+		resp, err := f.doOnce(ctx, tid, method, url, reqBody)
+		if !f.retry.retryable(resp, err) {
+			if err != nil {
+				logEntry.Warnf("Writer call %v [%v] failed at attempt %d of %d: %v. Not retrying", method, url, attempt, attempts, err)
+			} else {
+				logEntry.Infof("Writer call %v [%v] answered with status [%v] at attempt %d of %d", method, url, resp.Status, attempt, attempts)
+			}
+			return resp, err
+		}
+
+		failure := fmt.Sprintf("status [%v]", resp.Status)
+		if err != nil {
+			failure = err.Error()
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			logEntry.Warnf("Writer call %v [%v] failed at attempt %d of %d: %v. Giving up", method, url, attempt, attempts, failure)
+			return resp, err
+		}
+
+		delay := f.retry.delay(attempt)
+		logEntry.Warnf("Writer call %v [%v] failed at attempt %d of %d: %v. Retrying in %v", method, url, attempt, attempts, failure, delay)
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (f *defaultForwarder) doOnce(ctx context.Context, tid string, method string, url string, reqBody []byte) (ForwarderResponse, error) {
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return ForwarderResponse{}, err
 	}
-	req.Header.Add("Content-Type", "application/json")
+	if reqBody != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
 	req.Header.Set("User-Agent", "UPP content-collection-unfolder")
 	req.Header.Add(transactionidutils.TransactionIDHeader, tid)
 
-	resp, err := f.client.Do(req)
+	resp, err := f.client.Do(req.WithContext(ctx))
 	if err != nil {
 		return ForwarderResponse{}, err
 	}
@@ -55,5 +154,14 @@ func (f *defaultForwarder) Forward(tid string, uuid string, collectionType strin
 }
 
 func (f *defaultForwarder) buildUrl(collectionType string, uuid string) string {
-	return fmt.Sprintf("%s/%s/%s", f.writerUri, collectionType, uuid)
+	uri, ok := f.uriByType[collectionType]
+	if !ok {
+		uri = f.writerUri
+	}
+
+	// a base URI is used as given, like before templates were supported, even if it ends with a slash
+	if !strings.Contains(uri, uuidPlaceholder) {
+		return fmt.Sprintf("%s/%s/%s", uri, collectionType, uuid)
+	}
+	return strings.NewReplacer(collectionTypePlaceholder, collectionType, uuidPlaceholder, uuid).Replace(uri)
 }
@@ -1,10 +1,14 @@
 package forwarder
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/transactionid-utils-go"
 	"github.com/gorilla/mux"
@@ -86,3 +90,206 @@ func TestForwardingErrorResponse(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, resp.Status)
 	assert.Equal(t, []byte(testRespBody), resp.ResponseBody)
 }
+
+func mockDeletingWriter(t *testing.T, respStatus int) *httptest.Server {
+	router := mux.NewRouter()
+
+	router.HandleFunc(mockTestPath, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, testTid, transactionidutils.GetTransactionIDFromRequest(r))
+
+		vars := mux.Vars(r)
+		assert.Equal(t, testUuid, vars["uuid"])
+		assert.Equal(t, testCollection, vars["collectionType"])
+
+		w.WriteHeader(respStatus)
+	}).Methods(http.MethodDelete)
+
+	return httptest.NewServer(router)
+}
+
+func TestDeleteNoContentResponse(t *testing.T) {
+	mockServer := mockDeletingWriter(t, http.StatusNoContent)
+	defer mockServer.Close()
+
+	f := NewForwarder(http.DefaultClient, mockServer.URL+testPath)
+	resp, err := f.Delete(testTid, testUuid, testCollection)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.Status)
+	assert.Empty(t, resp.ResponseBody)
+}
+
+func TestDeleteNoSchema(t *testing.T) {
+	f := NewForwarder(http.DefaultClient, "some-bad-url")
+	_, err := f.Delete(testTid, testUuid, testCollection)
+
+	assert.Error(t, err)
+}
+
+func TestForwardingCancelled(t *testing.T) {
+	mockServer := mockWriter(t, http.StatusOK)
+	defer mockServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	f := NewForwarder(http.DefaultClient, mockServer.URL)
+	_, err := f.ForwardContext(ctx, testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.Error(t, err)
+}
+
+// flakyWriter answers with the given statuses in turn, then with 200, and counts the calls it gets.
+func flakyWriter(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, testTid, transactionidutils.GetTransactionIDFromRequest(r))
+
+		defer r.Body.Close()
+		reqBody, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(testReqBody), reqBody)
+
+		call := int(atomic.AddInt32(&calls, 1))
+		if call <= len(statuses) {
+			w.WriteHeader(statuses[call-1])
+			return
+		}
+		w.Write([]byte(testRespBody))
+	}))
+	return server, &calls
+}
+
+func testRetryPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond, Jitter: time.Millisecond, RetryableStatuses: []int{http.StatusServiceUnavailable}}
+}
+
+func TestForwardingRetriesRetryableStatus(t *testing.T) {
+	mockServer, calls := flakyWriter(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer mockServer.Close()
+
+	f := NewForwarderWithRetry(http.DefaultClient, mockServer.URL, testRetryPolicy(3))
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, []byte(testRespBody), resp.ResponseBody)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestForwardingGivesUpAfterMaxAttempts(t *testing.T) {
+	mockServer, calls := flakyWriter(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer mockServer.Close()
+
+	f := NewForwarderWithRetry(http.DefaultClient, mockServer.URL, testRetryPolicy(2))
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Status)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestForwardingDoesNotRetryOtherStatuses(t *testing.T) {
+	mockServer, calls := flakyWriter(t, http.StatusBadRequest)
+	defer mockServer.Close()
+
+	f := NewForwarderWithRetry(http.DefaultClient, mockServer.URL, testRetryPolicy(3))
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestForwardingRetriesTransportErrors(t *testing.T) {
+	mockServer, calls := flakyWriter(t)
+	defer mockServer.Close()
+
+	// the first connection is dropped before any answer
+	var dropped int32
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&dropped, 1) == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+
+	f := NewForwarderWithRetry(client, mockServer.URL, testRetryPolicy(3))
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestForwardingStopsRetryingWhenCancelled(t *testing.T) {
+	mockServer, calls := flakyWriter(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer mockServer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	retry := testRetryPolicy(3)
+	retry.BaseDelay = time.Minute
+	f := NewForwarderWithRetry(http.DefaultClient, mockServer.URL, retry)
+	resp, err := f.ForwardContext(ctx, testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Status)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+}
+
+func TestRetryDelay(t *testing.T) {
+	retry := RetryPolicy{BaseDelay: 100 * time.Millisecond}
+	assert.Equal(t, 100*time.Millisecond, retry.delay(1))
+	assert.Equal(t, 200*time.Millisecond, retry.delay(2))
+	assert.Equal(t, 400*time.Millisecond, retry.delay(3))
+
+	retry.Jitter = 50 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		delay := retry.delay(2)
+		assert.True(t, delay >= 200*time.Millisecond && delay < 250*time.Millisecond, "unexpected delay %v", delay)
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestForwardingUriTemplate(t *testing.T) {
+	mockServer := mockWriter(t, http.StatusOK)
+	defer mockServer.Close()
+
+	f := NewForwarder(http.DefaultClient, mockServer.URL+testPath+"/{collectionType}/{uuid}")
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.Status)
+}
+
+func TestBuildUrl(t *testing.T) {
+	f := NewForwarderWithOverrides(http.DefaultClient, "http://writer/content-collection", map[string]string{
+		"content-package": "http://package-writer/packages/{uuid}?type={collectionType}",
+		"curated-list":    "http://list-writer/lists",
+	}, NoRetry).(*defaultForwarder)
+
+	assert.Equal(t, "http://writer/content-collection/story-package/"+testUuid, f.buildUrl("story-package", testUuid))
+	assert.Equal(t, "http://package-writer/packages/"+testUuid+"?type=content-package", f.buildUrl("content-package", testUuid))
+	assert.Equal(t, "http://list-writer/lists/curated-list/"+testUuid, f.buildUrl("curated-list", testUuid))
+
+	f = NewForwarder(http.DefaultClient, "http://writer/{collectionType}/collections/{uuid}").(*defaultForwarder)
+	assert.Equal(t, "http://writer/story-package/collections/"+testUuid, f.buildUrl("story-package", testUuid))
+
+	// the trailing slash of a base URI, like the one of the default --writer-uri, is kept as before templates
+	f = NewForwarder(http.DefaultClient, "http://writer/content-collection/").(*defaultForwarder)
+	assert.Equal(t, "http://writer/content-collection//story-package/"+testUuid, f.buildUrl("story-package", testUuid))
+}
+
+func TestValidateWriterURI(t *testing.T) {
+	assert.NoError(t, ValidateWriterURI("http://writer/content-collection/"))
+	assert.NoError(t, ValidateWriterURI("http://writer/{collectionType}/{uuid}"))
+	assert.NoError(t, ValidateWriterURI("http://writer/content-package/{uuid}"))
+	assert.Error(t, ValidateWriterURI("http://writer/{collectionType}/"))
+}
@@ -0,0 +1,56 @@
+package forwarder
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
+)
+
+// RetryPolicy tells the forwarder how to retry the calls to the writer that failed for a transient reason.
+// Both PUT and DELETE are idempotent, so a call is safe to repeat.
+type RetryPolicy struct {
+	// MaxAttempts is the number of calls made at most, the first one included. 0 and 1 mean no retry.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled before every other one.
+	BaseDelay time.Duration
+	// Jitter is the most that is added at random to every wait, so that the retries of concurrent calls spread out.
+	Jitter time.Duration
+	// RetryableStatuses are the writer responses that are retried, besides the transport errors.
+	RetryableStatuses []int
+}
+
+// NoRetry makes a single call to the writer.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) retryable(resp ForwarderResponse, err error) bool {
+	if err != nil {
+		return !errors.Is(err, breaker.ErrOpen)
+	}
+	for _, status := range p.RetryableStatuses {
+		if resp.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// delay is the wait after the given failed attempt, counting from 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return delay
+}
@@ -0,0 +1,126 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"reflect"
+	"sync"
+	"time"
+
+	logger "github.com/Financial-Times/go-logger"
+)
+
+// shadowMetrics is published on the metrics endpoint: the PUTs replayed to the candidate writer, how many of them
+// matched the primary writer, differed in status or body, failed, or were dropped because too many were in flight.
+var shadowMetrics = expvar.NewMap("shadowWriter")
+
+// Drainer is implemented by the forwarders that keep calling writers in the background once they answered.
+type Drainer interface {
+	// Drain blocks until the calls in the background are done, up to the given timeout.
+	// It returns false if some of them were still running then.
+	Drain(timeout time.Duration) bool
+}
+
+type shadowForwarder struct {
+	Forwarder
+	candidate Forwarder
+	timeout   time.Duration
+	inFlight  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewShadowForwarder answers every call with the primary forwarder, and replays each PUT the primary writer answered
+// to the candidate in the background, comparing the two responses. The candidate never affects the client: its calls
+// get a context of their own that ends after timeout, and at most maxInFlight of them run at the same time.
+func NewShadowForwarder(primary Forwarder, candidate Forwarder, timeout time.Duration, maxInFlight int) Forwarder {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+	return &shadowForwarder{
+		Forwarder: primary,
+		candidate: candidate,
+		timeout:   timeout,
+		inFlight:  make(chan struct{}, maxInFlight),
+	}
+}
+
+func (f *shadowForwarder) Forward(tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	return f.ForwardContext(context.Background(), tid, uuid, collectionType, reqBody)
+}
+
+func (f *shadowForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	resp, err := f.Forwarder.ForwardContext(ctx, tid, uuid, collectionType, reqBody)
+	if err == nil {
+		f.replay(tid, uuid, collectionType, reqBody, resp)
+	}
+	return resp, err
+}
+
+func (f *shadowForwarder) replay(tid string, uuid string, collectionType string, reqBody []byte, primary ForwarderResponse) {
+	select {
+	case f.inFlight <- struct{}{}:
+	default:
+		shadowMetrics.Add("dropped", 1)
+		logger.WithField("tid", tid).Warnf("Skip replaying collection [%v] of type [%v] to the shadow writer. Too many replays in flight", uuid, collectionType)
+		return
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer func() { <-f.inFlight }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+		defer cancel()
+
+		candidate, err := f.candidate.ForwardContext(ctx, tid, uuid, collectionType, reqBody)
+		f.compare(tid, uuid, collectionType, primary, candidate, err)
+	}()
+}
+
+func (f *shadowForwarder) compare(tid string, uuid string, collectionType string, primary ForwarderResponse, candidate ForwarderResponse, err error) {
+	logEntry := logger.WithField("tid", tid)
+	shadowMetrics.Add("replayed", 1)
+	switch {
+	case err != nil:
+		shadowMetrics.Add("failed", 1)
+		logEntry.Warnf("Shadow writer failed for collection [%v] of type [%v]: %v", uuid, collectionType, err)
+	case primary.Status != candidate.Status:
+		shadowMetrics.Add("statusMismatches", 1)
+		logEntry.Warnf("Shadow writer mismatch for collection [%v] of type [%v]: primary status [%v], candidate status [%v]", uuid, collectionType, primary.Status, candidate.Status)
+	case !sameBody(primary.ResponseBody, candidate.ResponseBody):
+		shadowMetrics.Add("bodyMismatches", 1)
+		logEntry.Warnf("Shadow writer mismatch for collection [%v] of type [%v]: primary body [%s], candidate body [%s]", uuid, collectionType, primary.ResponseBody, candidate.ResponseBody)
+	default:
+		shadowMetrics.Add("matched", 1)
+	}
+}
+
+// Drain blocks until the replays in flight are done, which usually takes at most the timeout of the replays. A candidate
+// that does not give up when its context ends is not waited for longer than timeout though.
+func (f *shadowForwarder) Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		logger.Warnf("Shadow writer drain timed out after %v. Replays left in flight: %v", timeout, len(f.inFlight))
+		return false
+	}
+}
+
+// sameBody compares JSON bodies by value, so that formatting and key order do not count, and other bodies as bytes.
+func sameBody(primary []byte, candidate []byte) bool {
+	var primaryValue, candidateValue interface{}
+	if json.Unmarshal(primary, &primaryValue) == nil && json.Unmarshal(candidate, &candidateValue) == nil {
+		return reflect.DeepEqual(primaryValue, candidateValue)
+	}
+	return bytes.Equal(primary, candidate)
+}
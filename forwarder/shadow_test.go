@@ -0,0 +1,134 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingForwarder counts its calls and answers them once released.
+type blockingForwarder struct {
+	stubForwarder
+	calls    int32
+	released chan struct{}
+}
+
+func (b *blockingForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (ForwarderResponse, error) {
+	atomic.AddInt32(&b.calls, 1)
+	if b.released != nil {
+		<-b.released
+	}
+	return b.resp, b.err
+}
+
+func shadowMetric(name string) int64 {
+	if counter, ok := shadowMetrics.Get(name).(*expvar.Int); ok {
+		return counter.Value()
+	}
+	return 0
+}
+
+// shadowDelta forwards one PUT through a shadow forwarder and returns how much the given metric grew.
+func shadowDelta(t *testing.T, primary Forwarder, candidate Forwarder, metric string) int64 {
+	before := shadowMetric(metric)
+
+	f := NewShadowForwarder(primary, candidate, time.Second, 10)
+	resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.True(t, f.(Drainer).Drain(time.Second))
+
+	primaryResp, primaryErr := primary.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.Equal(t, primaryResp, resp)
+	assert.Equal(t, primaryErr, err)
+	return shadowMetric(metric) - before
+}
+
+func TestShadowMatched(t *testing.T) {
+	primary := answering(http.StatusOK, `{"uuid":"1","items":[]}`)
+	candidate := answering(http.StatusOK, `{ "items": [], "uuid": "1" }`)
+	assert.Equal(t, int64(1), shadowDelta(t, primary, candidate, "matched"))
+}
+
+func TestShadowStatusMismatch(t *testing.T) {
+	primary := answering(http.StatusOK, testRespBody)
+	candidate := answering(http.StatusBadRequest, testRespBody)
+	assert.Equal(t, int64(1), shadowDelta(t, primary, candidate, "statusMismatches"))
+}
+
+func TestShadowBodyMismatch(t *testing.T) {
+	primary := answering(http.StatusOK, testRespBody)
+	candidate := answering(http.StatusOK, "OK")
+	assert.Equal(t, int64(1), shadowDelta(t, primary, candidate, "bodyMismatches"))
+}
+
+func TestShadowCandidateFailureDoesNotAffectClient(t *testing.T) {
+	primary := answering(http.StatusOK, testRespBody)
+	candidate := stubForwarder{err: errors.New("connection refused")}
+	assert.Equal(t, int64(1), shadowDelta(t, primary, candidate, "failed"))
+}
+
+func TestShadowSkipsFailedPrimary(t *testing.T) {
+	primary := stubForwarder{err: errors.New("connection refused")}
+	candidate := &blockingForwarder{}
+	assert.Equal(t, int64(0), shadowDelta(t, primary, candidate, "replayed"))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&candidate.calls))
+}
+
+func TestShadowDropsReplaysOverLimit(t *testing.T) {
+	candidate := &blockingForwarder{stubForwarder: stubForwarder{resp: ForwarderResponse{Status: http.StatusOK}}, released: make(chan struct{})}
+	f := NewShadowForwarder(answering(http.StatusOK, ""), candidate, time.Second, 1)
+	before := shadowMetric("dropped")
+
+	for i := 0; i < 3; i++ {
+		resp, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.Status)
+	}
+	close(candidate.released)
+	assert.True(t, f.(Drainer).Drain(time.Second))
+
+	assert.Equal(t, int64(2), shadowMetric("dropped")-before)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&candidate.calls))
+}
+
+func TestShadowDoesNotReplayDeletes(t *testing.T) {
+	candidate := &blockingForwarder{}
+	f := NewShadowForwarder(answering(http.StatusNoContent, ""), candidate, time.Second, 10)
+
+	resp, err := f.Delete(testTid, testUuid, testCollection)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.Status)
+	assert.True(t, f.(Drainer).Drain(time.Second))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&candidate.calls))
+}
+
+func TestShadowDrainTimesOut(t *testing.T) {
+	candidate := &blockingForwarder{stubForwarder: stubForwarder{resp: ForwarderResponse{Status: http.StatusOK}}, released: make(chan struct{})}
+	f := NewShadowForwarder(answering(http.StatusOK, ""), candidate, time.Second, 10)
+
+	_, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+
+	assert.False(t, f.(Drainer).Drain(10*time.Millisecond), "a candidate ignoring its context must not block the shutdown")
+	close(candidate.released)
+	assert.True(t, f.(Drainer).Drain(time.Second))
+}
+
+func TestFanOutDrainsShadowTargets(t *testing.T) {
+	candidate := &blockingForwarder{stubForwarder: stubForwarder{resp: ForwarderResponse{Status: http.StatusOK}}, released: make(chan struct{})}
+	shadow := NewShadowForwarder(answering(http.StatusOK, ""), candidate, time.Second, 10)
+	f := newTestFanOut(t, AggregatePrimary, Target{Name: "shadowed", Forwarder: shadow, Required: true}, Target{Name: "other", Forwarder: answering(http.StatusOK, "")})
+	before := shadowMetric("replayed")
+
+	_, err := f.Forward(testTid, testUuid, testCollection, []byte(testReqBody))
+	assert.NoError(t, err)
+	time.AfterFunc(10*time.Millisecond, func() { close(candidate.released) })
+
+	assert.True(t, f.(Drainer).Drain(time.Second))
+	assert.Equal(t, int64(1), shadowMetric("replayed")-before)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	res "github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/content-collection-unfolder/ttlmap"
+)
+
+const (
+	defaultFreshnessCapacity = 10000
+	defaultFreshnessTTL      = 24 * time.Hour
+)
+
+// freshnessTracker remembers the newest lastModified accepted by the writer for each collection,
+// so that a delayed retry cannot overwrite a newer version of the collection.
+// At most capacity collections are remembered, each for ttl after its last accepted update, so the collections
+// updated least recently are forgotten first.
+type freshnessTracker struct {
+	mutex sync.Mutex
+	ttl   time.Duration
+	now   func() time.Time
+	// accepted holds the lastModified time of each collection by uuid
+	accepted *ttlmap.Map
+}
+
+func newFreshnessTracker(capacity int, ttl time.Duration) *freshnessTracker {
+	return &freshnessTracker{
+		ttl:      ttl,
+		now:      time.Now,
+		accepted: ttlmap.New(capacity),
+	}
+}
+
+// checkFresh returns an error if the collection already had a newer version accepted.
+// Versions with the same lastModified are not stale, repeating a publish is up to the idempotency store.
+func (f *freshnessTracker) checkFresh(uuid string, lastModified string) error {
+	incoming, err := time.Parse(res.DateTimeFormat, lastModified)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if accepted, ok := f.accepted.Get(uuid, f.now()); ok && incoming.Before(accepted.(time.Time)) {
+		return fmt.Errorf("collection lastModified [%v] is older than the one of the last accepted update [%v]", lastModified, accepted.(time.Time).Format(res.DateTimeFormat))
+	}
+	return nil
+}
+
+func (f *freshnessTracker) accept(uuid string, lastModified string) {
+	incoming, err := time.Parse(res.DateTimeFormat, lastModified)
+	if err != nil {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	now := f.now()
+	if accepted, ok := f.accepted.Get(uuid, now); ok && !incoming.After(accepted.(time.Time)) {
+		return
+	}
+	f.accepted.Put(uuid, incoming, now.Add(f.ttl))
+}
+
+// forget drops the version accepted for a deleted collection, so that it can be published again from scratch.
+func (f *freshnessTracker) forget(uuid string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.accepted.Remove(uuid)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreshness_OlderUpdateIsStale(t *testing.T) {
+	f := newFreshnessTracker(defaultFreshnessCapacity, defaultFreshnessTTL)
+
+	assert.NoError(t, f.checkFresh(collectionUuid, "2017-01-31T15:33:21.687Z"))
+	f.accept(collectionUuid, "2017-01-31T15:33:21.687Z")
+
+	assert.Error(t, f.checkFresh(collectionUuid, "2017-01-31T15:30:00.000Z"))
+	assert.NoError(t, f.checkFresh(collectionUuid, "2017-01-31T15:33:21.687Z"))
+	assert.NoError(t, f.checkFresh(collectionUuid, "2017-01-31T15:40:00.000Z"))
+	assert.NoError(t, f.checkFresh(firstExistingItemUuid, "2017-01-31T15:30:00.000Z"))
+}
+
+func TestFreshness_OlderAcceptDoesNotRewind(t *testing.T) {
+	f := newFreshnessTracker(defaultFreshnessCapacity, defaultFreshnessTTL)
+
+	f.accept(collectionUuid, "2017-01-31T15:33:21.687Z")
+	f.accept(collectionUuid, "2017-01-31T15:30:00.000Z")
+
+	assert.Error(t, f.checkFresh(collectionUuid, "2017-01-31T15:31:00.000Z"))
+}
+
+func TestFreshness_InvalidLastModified(t *testing.T) {
+	f := newFreshnessTracker(defaultFreshnessCapacity, defaultFreshnessTTL)
+
+	assert.Error(t, f.checkFresh(collectionUuid, "yesterday"))
+}
+
+func TestFreshness_LeastRecentlyUpdatedIsForgottenWhenFull(t *testing.T) {
+	f := newFreshnessTracker(2, defaultFreshnessTTL)
+
+	f.accept(collectionUuid, "2017-01-31T15:33:21.687Z")
+	f.accept(firstExistingItemUuid, "2017-01-31T15:33:21.687Z")
+	f.accept(collectionUuid, "2017-01-31T15:40:00.000Z")
+	f.accept(secondExistingItemUuid, "2017-01-31T15:33:21.687Z")
+
+	assert.Equal(t, 2, f.accepted.Len())
+	assert.Error(t, f.checkFresh(collectionUuid, "2017-01-31T15:30:00.000Z"))
+	assert.NoError(t, f.checkFresh(firstExistingItemUuid, "2017-01-31T15:30:00.000Z"))
+	assert.Error(t, f.checkFresh(secondExistingItemUuid, "2017-01-31T15:30:00.000Z"))
+}
+
+func TestFreshness_ExpiredVersionIsForgotten(t *testing.T) {
+	now := time.Now()
+	f := newFreshnessTracker(defaultFreshnessCapacity, time.Minute)
+	f.now = func() time.Time { return now }
+
+	f.accept(collectionUuid, "2017-01-31T15:33:21.687Z")
+	assert.Error(t, f.checkFresh(collectionUuid, "2017-01-31T15:30:00.000Z"))
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, f.checkFresh(collectionUuid, "2017-01-31T15:30:00.000Z"))
+	assert.Zero(t, f.accepted.Len())
+}
+
+func TestFreshness_ForgetDeletedCollection(t *testing.T) {
+	f := newFreshnessTracker(defaultFreshnessCapacity, defaultFreshnessTTL)
+
+	f.accept(collectionUuid, "2017-01-31T15:33:21.687Z")
+	f.forget(collectionUuid)
+
+	assert.NoError(t, f.checkFresh(collectionUuid, "2017-01-31T15:30:00.000Z"))
+	assert.Zero(t, f.accepted.Len())
+}
@@ -24,6 +24,7 @@ require (
 	github.com/stretchr/objx v0.0.0-20140526180921-cbeaeb16a013 // indirect
 	github.com/stretchr/testify v1.1.5-0.20170526065633-eb84487caee2
 	github.com/willf/bitset v1.0.1-0.20161202170036-5c3c0fce4884 // indirect
+	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/crypto v0.0.0-20190123085648-057139ce5d2b // indirect
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
@@ -4,8 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
 	health "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
 	"github.com/Financial-Times/service-status-go/gtg"
@@ -16,6 +18,8 @@ const healthPath = "/__health"
 type healthService struct {
 	config *healthConfig
 	checks []health.Check
+	// gtgChecks are the checks the service is not good to go without, which leaves out the best-effort writers
+	gtgChecks []health.Check
 }
 
 type healthConfig struct {
@@ -27,7 +31,19 @@ type healthConfig struct {
 	contentResolverHealthURI   string
 	relationsResolverHealthURI string
 	producer                   producer.MessageProducer
+	topicProducers             map[string]producer.MessageProducer
 	client                     *http.Client
+	writerBreaker              *breaker.Breaker
+	contentResolverBreaker     *breaker.Breaker
+	relationsResolverBreaker   *breaker.Breaker
+	extraWriters               []extraWriter
+}
+
+// extraWriter is one of the --extra-writer-uris. Its health endpoint is not known, so only its circuit breaker is checked.
+type extraWriter struct {
+	uri      string
+	required bool
+	breaker  *breaker.Breaker
 }
 
 func newHealthService(config *healthConfig) *healthService {
@@ -38,6 +54,22 @@ func newHealthService(config *healthConfig) *healthService {
 		service.relationsResolverCheck(),
 		service.producerCheck(),
 	}
+	topics := make([]string, 0, len(config.topicProducers))
+	for topic := range config.topicProducers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		service.checks = append(service.checks, service.topicProducerCheck(topic, config.topicProducers[topic]))
+	}
+	service.gtgChecks = append([]health.Check{}, service.checks...)
+	for _, writer := range config.extraWriters {
+		check := service.extraWriterCheck(writer)
+		service.checks = append(service.checks, check)
+		if writer.required {
+			service.gtgChecks = append(service.gtgChecks, check)
+		}
+	}
 	return &service
 }
 
@@ -97,67 +129,106 @@ func (service *healthService) producerCheck() health.Check {
 	}
 }
 
+// topicProducerCheck checks the producer of a topic some collection types are unfolded to, besides the default one.
+func (service *healthService) topicProducerCheck(topic string, topicProducer producer.MessageProducer) health.Check {
+	return health.Check{
+		BusinessImpact:   fmt.Sprintf("No notifications will be created for the content in collections unfolded to topic [%v]", topic),
+		Name:             fmt.Sprintf("Message producer health check for topic [%v]", topic),
+		PanicGuide:       "https://runbooks.in.ft.com/kafka-proxy",
+		Severity:         2,
+		TechnicalSummary: fmt.Sprintf("Checks if Kafka can be accessed through http proxy for topic [%v]", topic),
+		Checker:          topicProducer.ConnectivityCheck,
+	}
+}
+
+// extraWriterCheck fails while the breaker of the writer is open. Only the required writers fail the unfolding then.
+func (service *healthService) extraWriterCheck(writer extraWriter) health.Check {
+	check := health.Check{
+		BusinessImpact:   fmt.Sprintf("Content collections will not be written to the best-effort writer [%v]", writer.uri),
+		Name:             fmt.Sprintf("Extra writer circuit breaker health check for [%v]", writer.uri),
+		PanicGuide:       "https://runbooks.in.ft.com/upp-content-collection-rw-neo4j",
+		Severity:         3,
+		TechnicalSummary: fmt.Sprintf("Checks if the circuit breaker of the extra writer [%v] lets the calls through", writer.uri),
+		Checker: func() (string, error) {
+			return extraWriterChecker(writer.breaker)
+		},
+	}
+	if writer.required {
+		check.BusinessImpact = "Content relationships to packages will not be written / updated"
+		check.Severity = 2
+	}
+	return check
+}
+
 func (service *healthService) writerChecker() (string, error) {
-	return service.httpAvailabilityChecker(service.config.writerHealthURI)
+	return service.httpAvailabilityChecker(service.config.writerHealthURI, service.config.writerBreaker)
 }
 
 func (service *healthService) contentResolverChecker() (string, error) {
-	return service.httpAvailabilityChecker(service.config.contentResolverHealthURI)
+	return service.httpAvailabilityChecker(service.config.contentResolverHealthURI, service.config.contentResolverBreaker)
 }
 
 func (service *healthService) relationsResolverChecker() (string, error) {
-	return service.httpAvailabilityChecker(service.config.relationsResolverHealthURI)
+	return service.httpAvailabilityChecker(service.config.relationsResolverHealthURI, service.config.relationsResolverBreaker)
 }
 
 func (service *healthService) producerChecker() (string, error) {
 	return service.config.producer.ConnectivityCheck()
 }
 
-func (service *healthService) httpAvailabilityChecker(healthUri string) (string, error) {
+// httpAvailabilityChecker calls the health endpoint of a dependency and reports the state of its circuit breaker too.
+// The check fails while the breaker is open, since the calls to the dependency fail without being made.
+func (service *healthService) httpAvailabilityChecker(healthUri string, b *breaker.Breaker) (string, error) {
+	if b != nil && b.State() == breaker.Open {
+		msg := fmt.Sprintf("Circuit breaker [%v] is open, calls to the service fail fast", b.Name())
+		return msg, errors.New(msg)
+	}
+
 	req, err := http.NewRequest(http.MethodGet, healthUri, nil)
 	if err != nil {
-		msg := fmt.Sprintf("Error while creating http health check request: %v", err)
+		msg := fmt.Sprintf("Error while creating http health check request: %v%v", err, breakerState(b))
 		return msg, errors.New(msg)
 	}
 
 	resp, err := service.config.client.Do(req)
 	if err != nil {
-		msg := fmt.Sprintf("Error contacting the service: %v", err)
+		msg := fmt.Sprintf("Error contacting the service: %v%v", err, breakerState(b))
 		return msg, errors.New(msg)
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		msg := fmt.Sprintf("Service did not responde with OK. Status was %v", resp.Status)
+		msg := fmt.Sprintf("Service did not responde with OK. Status was %v%v", resp.Status, breakerState(b))
 		return msg, errors.New(msg)
 	}
 
-	return "OK", nil
+	return "OK" + breakerState(b), nil
 }
 
-func (service *healthService) GTG() gtg.Status {
-	writerCheck := func() gtg.Status {
-		return gtgCheck(service.writerChecker)
-	}
-
-	contentResolverCheck := func() gtg.Status {
-		return gtgCheck(service.contentResolverChecker)
+func extraWriterChecker(b *breaker.Breaker) (string, error) {
+	if b.State() == breaker.Open {
+		msg := fmt.Sprintf("Circuit breaker [%v] is open, calls to the writer fail fast", b.Name())
+		return msg, errors.New(msg)
 	}
+	return fmt.Sprintf("Circuit breaker [%v] is %v", b.Name(), b.State()), nil
+}
 
-	relationsResolverCheck := func() gtg.Status {
-		return gtgCheck(service.relationsResolverChecker)
+func breakerState(b *breaker.Breaker) string {
+	if b == nil {
+		return ""
 	}
+	return fmt.Sprintf(". Circuit breaker [%v] is %v", b.Name(), b.State())
+}
 
-	producerCheck := func() gtg.Status {
-		return gtgCheck(service.producerChecker)
+func (service *healthService) GTG() gtg.Status {
+	checkers := []gtg.StatusChecker{}
+	for _, check := range service.gtgChecks {
+		checker := check.Checker
+		checkers = append(checkers, func() gtg.Status {
+			return gtgCheck(checker)
+		})
 	}
-
-	return gtg.FailFastParallelCheck([]gtg.StatusChecker{
-		writerCheck,
-		contentResolverCheck,
-		relationsResolverCheck,
-		producerCheck,
-	})()
+	return gtg.FailFastParallelCheck(checkers)()
 }
 
 func gtgCheck(handler func() (string, error)) gtg.Status {
@@ -0,0 +1,167 @@
+package idempotency
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/atomicfile"
+	logger "github.com/Financial-Times/go-logger"
+)
+
+type fileStore struct {
+	*memoryStore
+	fileName string
+	file     *os.File
+	// records is the number of lines in the file, which is compacted once they far outnumber the outcomes kept
+	records int
+}
+
+// storedEntry is one line of the file: a remembered outcome, or the collection of a Forget.
+type storedEntry struct {
+	CollectionUUID   string    `json:"collectionUuid"`
+	PublishReference string    `json:"publishReference,omitempty"`
+	LastModified     string    `json:"lastModified,omitempty"`
+	Status           int       `json:"status,omitempty"`
+	Body             []byte    `json:"body,omitempty"`
+	Expires          time.Time `json:"expires"`
+	Forgotten        bool      `json:"forgotten,omitempty"`
+}
+
+// NewFileStore works like the memory store, but also writes the outcomes to fileName so that they survive a restart.
+// Every change is appended to the file as a line of its own. The file is rewritten with only the outcomes still kept on
+// startup, and whenever it grows to twice the capacity. A missing file is treated as an empty store.
+func NewFileStore(fileName string, capacity int, ttl time.Duration) (Store, error) {
+	return newFileStore(fileName, newMemoryStore(capacity, ttl, time.Now))
+}
+
+func newFileStore(fileName string, memory *memoryStore) (*fileStore, error) {
+	s := fileStore{memoryStore: memory, fileName: fileName}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read idempotency file [%v]: %v", fileName, err)
+	}
+	if err := s.load(data); err != nil {
+		return nil, fmt.Errorf("unable to parse idempotency file [%v]: %v", fileName, err)
+	}
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("unable to write idempotency file [%v]: %v", fileName, err)
+	}
+
+	return &s, nil
+}
+
+// load replays the lines of the file. A crash while appending can only leave the last line incomplete, which is ignored.
+func (s *fileStore) load(data []byte) error {
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var se storedEntry
+		if err := json.Unmarshal(line, &se); err != nil {
+			if i == len(lines)-1 {
+				logger.Warnf("Ignoring the incomplete last line of idempotency file [%v]: %v", s.fileName, err)
+				break
+			}
+			return fmt.Errorf("line %d: %v", i+1, err)
+		}
+
+		if se.Forgotten {
+			s.forget(se.CollectionUUID)
+			continue
+		}
+		s.add(entry{
+			key:     Key{CollectionUUID: se.CollectionUUID, PublishReference: se.PublishReference, LastModified: se.LastModified},
+			outcome: Outcome{Status: se.Status, Body: se.Body},
+			expires: se.Expires,
+		})
+	}
+	s.removeExpired()
+	return nil
+}
+
+func (s *fileStore) Put(key Key, outcome Outcome) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e := entry{key: key, outcome: outcome, expires: s.now().Add(s.ttl)}
+	s.add(e)
+	if err := s.append(stored(e)); err != nil {
+		logger.Warnf("Unable to write idempotency file [%v]: %v", s.fileName, err)
+	}
+}
+
+func (s *fileStore) Forget(collectionUUID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.forget(collectionUUID)
+	if err := s.append(storedEntry{CollectionUUID: collectionUUID, Forgotten: true}); err != nil {
+		logger.Warnf("Unable to write idempotency file [%v]: %v", s.fileName, err)
+	}
+}
+
+// append adds the line of a change that is already made in memory. When the file has grown too long, or could not be
+// opened the last time, it is compacted instead, which writes the change as well.
+func (s *fileStore) append(se storedEntry) error {
+	if s.file == nil || s.records >= 2*s.capacity {
+		return s.compact()
+	}
+
+	line, err := json.Marshal(se)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.records++
+	return nil
+}
+
+// compact replaces the file with the outcomes still kept and opens it for appending.
+func (s *fileStore) compact() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	var data bytes.Buffer
+	entries := s.snapshot()
+	for _, e := range entries {
+		line, err := json.Marshal(stored(e))
+		if err != nil {
+			return err
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+	}
+	if err := atomicfile.Write(s.fileName, data.Bytes()); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.records = len(entries)
+	return nil
+}
+
+func stored(e entry) storedEntry {
+	return storedEntry{
+		CollectionUUID:   e.key.CollectionUUID,
+		PublishReference: e.key.PublishReference,
+		LastModified:     e.key.LastModified,
+		Status:           e.outcome.Status,
+		Body:             e.outcome.Body,
+		Expires:          e.expires,
+	}
+}
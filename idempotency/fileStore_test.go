@@ -0,0 +1,126 @@
+package idempotency
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore_OutcomesSurviveRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "publishes.json")
+
+	s, err := NewFileStore(fileName, 10, time.Minute)
+	assert.NoError(t, err)
+	s.Put(firstKey, outcome)
+
+	restarted, err := NewFileStore(fileName, 10, time.Minute)
+	assert.NoError(t, err)
+
+	actual, found := restarted.Get(firstKey)
+	assert.True(t, found)
+	assert.Equal(t, outcome, actual)
+}
+
+func TestFileStore_ExpiredOutcomesAreNotLoaded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "publishes.json")
+
+	c := &clock{current: time.Now()}
+	s, err := newFileStore(fileName, newMemoryStore(10, time.Minute, c.now))
+	assert.NoError(t, err)
+	s.Put(firstKey, outcome)
+
+	c.current = c.current.Add(2 * time.Minute)
+	restarted, err := newFileStore(fileName, newMemoryStore(10, time.Minute, c.now))
+	assert.NoError(t, err)
+
+	_, found := restarted.Get(firstKey)
+	assert.False(t, found)
+}
+
+func TestFileStore_InvalidFile(t *testing.T) {
+	_, err := NewFileStore("../test-resources/relations-api-wrong-json-response.json", 10, time.Minute)
+
+	assert.Error(t, err)
+}
+
+func TestFileStore_ChangesAreAppended(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "publishes.json")
+
+	s, err := NewFileStore(fileName, 10, time.Minute)
+	assert.NoError(t, err)
+	s.Put(firstKey, outcome)
+	s.Put(secondKey, outcome)
+	s.Put(thirdKey, outcome)
+	s.Forget(firstKey.CollectionUUID)
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(data), "\n"))
+
+	restarted, err := NewFileStore(fileName, 10, time.Minute)
+	assert.NoError(t, err)
+
+	_, found := restarted.Get(firstKey)
+	assert.False(t, found, "forgotten outcomes must stay forgotten")
+	_, found = restarted.Get(thirdKey)
+	assert.True(t, found)
+
+	data, err = ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"), "the file must be compacted on startup")
+}
+
+func TestFileStore_IsCompactedWhenTwiceTheCapacity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "publishes.json")
+
+	s, err := NewFileStore(fileName, 1, time.Minute)
+	assert.NoError(t, err)
+	s.Put(firstKey, outcome)
+	s.Put(secondKey, outcome)
+	s.Put(thirdKey, outcome)
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "\n"), "only the outcome kept may be left after the third put")
+	assert.Contains(t, string(data), thirdKey.PublishReference)
+}
+
+func TestFileStore_IncompleteLastLineIsIgnored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idempotency")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "publishes.json")
+
+	s, err := NewFileStore(fileName, 10, time.Minute)
+	assert.NoError(t, err)
+	s.Put(firstKey, outcome)
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"collectionUuid":"d4986a58`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	restarted, err := NewFileStore(fileName, 10, time.Minute)
+	assert.NoError(t, err)
+
+	_, found := restarted.Get(firstKey)
+	assert.True(t, found)
+}
@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/ttlmap"
+)
+
+// Key identifies one publish of a collection. Publishing retries resend the same key.
+type Key struct {
+	CollectionUUID   string
+	PublishReference string
+	LastModified     string
+}
+
+// Outcome is the response given to the first request of a publish.
+type Outcome struct {
+	Status int
+	Body   []byte
+}
+
+// Store remembers the outcome of processed publishes for a limited time.
+type Store interface {
+	Get(key Key) (Outcome, bool)
+	Put(key Key, outcome Outcome)
+	// Forget drops the outcomes of every publish of the collection.
+	Forget(collectionUUID string)
+}
+
+type entry struct {
+	key     Key
+	outcome Outcome
+	expires time.Time
+}
+
+type memoryStore struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+	outcomes *ttlmap.Map
+}
+
+// NewMemoryStore keeps up to capacity outcomes for ttl each. When full, the oldest outcome is forgotten first.
+func NewMemoryStore(capacity int, ttl time.Duration) Store {
+	return newMemoryStore(capacity, ttl, time.Now)
+}
+
+func newMemoryStore(capacity int, ttl time.Duration, now func() time.Time) *memoryStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &memoryStore{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      now,
+		outcomes: ttlmap.New(capacity),
+	}
+}
+
+func (s *memoryStore) Get(key Key) (Outcome, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	outcome, ok := s.outcomes.Get(key, s.now())
+	if !ok {
+		return Outcome{}, false
+	}
+	return outcome.(Outcome), true
+}
+
+func (s *memoryStore) Put(key Key, outcome Outcome) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.add(entry{key: key, outcome: outcome, expires: s.now().Add(s.ttl)})
+}
+
+func (s *memoryStore) Forget(collectionUUID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.forget(collectionUUID)
+}
+
+func (s *memoryStore) add(e entry) {
+	s.outcomes.Put(e.key, e.outcome, e.expires)
+}
+
+func (s *memoryStore) forget(collectionUUID string) {
+	s.outcomes.RemoveIf(func(key interface{}) bool {
+		return key.(Key).CollectionUUID == collectionUUID
+	})
+}
+
+func (s *memoryStore) removeExpired() {
+	s.outcomes.RemoveExpired(s.now())
+}
+
+func (s *memoryStore) snapshot() []entry {
+	kept := s.outcomes.Entries(s.now())
+	entries := make([]entry, len(kept))
+	for i, e := range kept {
+		entries[i] = entry{key: e.Key.(Key), outcome: e.Value.(Outcome), expires: e.Expires}
+	}
+	return entries
+}
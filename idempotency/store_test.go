@@ -0,0 +1,86 @@
+package idempotency
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	firstKey  = Key{CollectionUUID: "45163790-eec9-11e6-abbc-ee7d9c5b3b90", PublishReference: "tid_1", LastModified: "2017-01-31T15:33:21.687Z"}
+	secondKey = Key{CollectionUUID: "45163790-eec9-11e6-abbc-ee7d9c5b3b90", PublishReference: "tid_2", LastModified: "2017-01-31T15:34:21.687Z"}
+	thirdKey  = Key{CollectionUUID: "d4986a58-de3b-11e6-86ac-f253db7791c6", PublishReference: "tid_3", LastModified: "2017-01-31T15:35:21.687Z"}
+	outcome   = Outcome{Status: http.StatusOK, Body: []byte(`{"unfolding":"done"}`)}
+)
+
+type clock struct {
+	current time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.current
+}
+
+func TestMemoryStore_GetAfterPut(t *testing.T) {
+	s := NewMemoryStore(10, time.Minute)
+
+	_, found := s.Get(firstKey)
+	assert.False(t, found)
+
+	s.Put(firstKey, outcome)
+
+	actual, found := s.Get(firstKey)
+	assert.True(t, found)
+	assert.Equal(t, outcome, actual)
+
+	_, found = s.Get(secondKey)
+	assert.False(t, found)
+}
+
+func TestMemoryStore_OutcomesExpire(t *testing.T) {
+	c := &clock{current: time.Now()}
+	s := newMemoryStore(10, time.Minute, c.now)
+
+	s.Put(firstKey, outcome)
+	c.current = c.current.Add(30 * time.Second)
+	s.Put(secondKey, outcome)
+	c.current = c.current.Add(45 * time.Second)
+
+	_, found := s.Get(firstKey)
+	assert.False(t, found)
+	_, found = s.Get(secondKey)
+	assert.True(t, found)
+}
+
+func TestMemoryStore_OldestOutcomeIsEvictedWhenFull(t *testing.T) {
+	s := NewMemoryStore(2, time.Minute)
+
+	s.Put(firstKey, outcome)
+	s.Put(secondKey, outcome)
+	s.Put(thirdKey, outcome)
+
+	_, found := s.Get(firstKey)
+	assert.False(t, found)
+	_, found = s.Get(secondKey)
+	assert.True(t, found)
+	_, found = s.Get(thirdKey)
+	assert.True(t, found)
+}
+
+func TestMemoryStore_ForgetCollection(t *testing.T) {
+	s := NewMemoryStore(10, time.Minute)
+
+	s.Put(firstKey, outcome)
+	s.Put(secondKey, outcome)
+	s.Put(thirdKey, outcome)
+	s.Forget(firstKey.CollectionUUID)
+
+	_, found := s.Get(firstKey)
+	assert.False(t, found)
+	_, found = s.Get(secondKey)
+	assert.False(t, found)
+	_, found = s.Get(thirdKey)
+	assert.True(t, found)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultCollectionLockTimeout = 10 * time.Second
+
+var errCollectionLockTimeout = errors.New("timed out waiting for another update of the same collection to finish")
+
+// lockMetrics is published on the metrics endpoint. waitNanos only counts the time spent waiting on contended locks.
+var lockMetrics = expvar.NewMap("collectionLocks")
+
+// collectionLocks serializes the updates of each collection, so that the diff of an update is always computed
+// against the relations written by the previous one.
+type collectionLocks struct {
+	mutex   sync.Mutex
+	locks   map[string]*collectionLock
+	timeout time.Duration
+}
+
+type collectionLock struct {
+	held chan struct{}
+	refs int
+}
+
+// heldLock is the lock of a collection taken by a request. The unfolding job the request queues shares it, so that
+// the next update of the collection waits for the notifications of this one to be sent.
+type heldLock struct {
+	holders int32
+	unlock  func()
+}
+
+func newHeldLock(unlock func()) *heldLock {
+	return &heldLock{holders: 1, unlock: unlock}
+}
+
+// share adds a holder to the lock. The returned function releases its share.
+func (h *heldLock) share() func() {
+	atomic.AddInt32(&h.holders, 1)
+	return h.release
+}
+
+// release lets go of the lock once every holder released it.
+func (h *heldLock) release() {
+	if atomic.AddInt32(&h.holders, -1) == 0 {
+		h.unlock()
+	}
+}
+
+func newCollectionLocks(timeout time.Duration) *collectionLocks {
+	return &collectionLocks{
+		locks:   map[string]*collectionLock{},
+		timeout: timeout,
+	}
+}
+
+// acquire waits up to the timeout for the lock of the collection. The returned function releases it.
+func (l *collectionLocks) acquire(uuid string) (func(), error) {
+	lock := l.ref(uuid)
+
+	select {
+	case lock.held <- struct{}{}:
+		lockMetrics.Add("acquired", 1)
+		return func() { l.release(uuid, lock) }, nil
+	default:
+	}
+
+	lockMetrics.Add("contended", 1)
+	start := time.Now()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case lock.held <- struct{}{}:
+		lockMetrics.Add("acquired", 1)
+		lockMetrics.Add("waitNanos", int64(time.Since(start)))
+		return func() { l.release(uuid, lock) }, nil
+	case <-timer.C:
+		lockMetrics.Add("timeouts", 1)
+		lockMetrics.Add("waitNanos", int64(time.Since(start)))
+		l.unref(uuid, lock)
+		return nil, errCollectionLockTimeout
+	}
+}
+
+func (l *collectionLocks) release(uuid string, lock *collectionLock) {
+	<-lock.held
+	l.unref(uuid, lock)
+}
+
+func (l *collectionLocks) ref(uuid string) *collectionLock {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lock, ok := l.locks[uuid]
+	if !ok {
+		lock = &collectionLock{held: make(chan struct{}, 1)}
+		l.locks[uuid] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// unref forgets the lock once nobody holds it or waits for it, so the map does not grow with every collection ever seen.
+func (l *collectionLocks) unref(uuid string, lock *collectionLock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, uuid)
+	}
+}
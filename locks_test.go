@@ -0,0 +1,86 @@
+package main
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocksSerializeUpdatesOfTheSameCollection(t *testing.T) {
+	l := newCollectionLocks(time.Second)
+
+	release, err := l.acquire(collectionUuid)
+	assert.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		secondRelease, err := l.acquire(collectionUuid)
+		assert.NoError(t, err)
+		close(acquired)
+		secondRelease()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	<-acquired
+}
+
+func TestLocksOfDifferentCollectionsAreIndependent(t *testing.T) {
+	l := newCollectionLocks(10 * time.Millisecond)
+
+	release, err := l.acquire(collectionUuid)
+	assert.NoError(t, err)
+	defer release()
+
+	otherRelease, err := l.acquire(firstExistingItemUuid)
+	assert.NoError(t, err)
+	otherRelease()
+}
+
+func TestLockTimeout(t *testing.T) {
+	l := newCollectionLocks(10 * time.Millisecond)
+	timeoutsBefore := lockCounter("timeouts")
+
+	release, err := l.acquire(collectionUuid)
+	assert.NoError(t, err)
+
+	_, err = l.acquire(collectionUuid)
+	assert.Equal(t, errCollectionLockTimeout, err)
+	assert.Equal(t, timeoutsBefore+1, lockCounter("timeouts"))
+
+	release()
+	assert.Empty(t, l.locks)
+}
+
+func lockCounter(name string) int64 {
+	counter, ok := lockMetrics.Get(name).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return counter.Value()
+}
+
+func TestHeldLockIsReleasedByItsLastHolder(t *testing.T) {
+	l := newCollectionLocks(10 * time.Millisecond)
+
+	release, err := l.acquire(collectionUuid)
+	assert.NoError(t, err)
+	lock := newHeldLock(release)
+	jobRelease := lock.share()
+
+	lock.release()
+	_, err = l.acquire(collectionUuid)
+	assert.Equal(t, errCollectionLockTimeout, err, "the queued job still holds the lock")
+
+	jobRelease()
+	otherRelease, err := l.acquire(collectionUuid)
+	assert.NoError(t, err)
+	otherRelease()
+}
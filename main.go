@@ -1,16 +1,23 @@
 package main
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
 	"github.com/Financial-Times/content-collection-unfolder/differ"
 	fw "github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/idempotency"
+	"github.com/Financial-Times/content-collection-unfolder/outbox"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
 	prod "github.com/Financial-Times/content-collection-unfolder/producer"
 	"github.com/Financial-Times/content-collection-unfolder/relations"
 	res "github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/content-collection-unfolder/schema"
 	logger "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
 	"github.com/jawher/mow.cli"
@@ -30,18 +37,56 @@ func main() {
 	app.Action = func() {
 		logger.Infof("[Startup] content-collection-unfolder is starting with service config %v", sc.toMap())
 
+		policies := setupPolicies(sc)
 		client := setupHttpClient()
-		producer := setupMessageProducer(sc, client)
+		producer := setupMessageProducer(sc, client, *sc.writeTopic)
+		topicProducers := setupTopicProducers(sc, client, policies.Topics())
+		writerBreaker := setupBreaker(sc, "content-collection-rw-neo4j")
+		relationsResolverBreaker := setupBreaker(sc, "relations-api")
+		contentResolverBreaker := setupBreaker(sc, "document-store-api")
+
+		forwarder, extraWriters := setupForwarder(sc, client, writerBreaker)
 
 		unfolder := newUnfolder(
-			res.NewUuidResolver(),
-			relations.NewDefaultRelationsResolver(client, *sc.relationsResolverURI),
+			res.NewUuidResolverWithMaxItems(*sc.maxCollectionItems),
+			relations.NewDefaultRelationsResolver(relationsResolverBreaker.Client(client), *sc.relationsResolverURI),
 			differ.NewDefaultCollectionsDiffer(),
-			fw.NewForwarder(client, *sc.writerURI),
-			res.NewContentResolver(client, *sc.contentResolverURI, time.Duration(*sc.requestTimeout)*time.Second),
-			prod.NewContentProducer(producer),
-			*sc.unfoldingWhitelist,
+			forwarder,
+			res.NewContentResolver(contentResolverBreaker.Client(client), *sc.contentResolverURI, time.Duration(*sc.requestTimeout)*time.Second),
+			prod.NewContentProducerWithTopics(producer, topicProducers),
+			policies,
 		)
+		if err := unfolder.setSendFailurePolicy(*sc.sendFailurePolicy); err != nil {
+			logger.Fatalf("Invalid configuration: %v", err)
+		}
+		unfolder.setCollectionLockTimeout(time.Duration(*sc.collectionLockTimeout) * time.Second)
+		unfolder.setFreshnessLimits(*sc.freshnessCapacity, time.Duration(*sc.freshnessTTL)*time.Second)
+		unfolder.setBatchConcurrency(*sc.batchConcurrency)
+		unfolder.setBatchLimits(*sc.batchMaxLines, int64(*sc.batchMaxBytes))
+		unfolder.setRequestDeadline(time.Duration(*sc.requestDeadline) * time.Second)
+		if *sc.collectionSchemasDir != "" {
+			schemas, err := schema.LoadDir(*sc.collectionSchemasDir)
+			if err != nil {
+				logger.Fatalf("Unable to load collection schemas: %v", err)
+			}
+			unfolder.setSchemas(schemas)
+		}
+		if publishes := setupIdempotencyStore(sc); publishes != nil {
+			unfolder.enableIdempotency(publishes)
+		}
+		if *sc.outboxDir != "" {
+			o, err := outbox.NewFileOutbox(*sc.outboxDir)
+			if err != nil {
+				logger.Fatalf("Unable to open outbox: %v", err)
+			}
+			unfolder.enableOutbox(o, time.Duration(*sc.outboxRetryInterval)*time.Second, *sc.outboxMaxAttempts)
+		}
+		if err := unfolder.checkSendFailurePolicy(); err != nil {
+			logger.Fatalf("Invalid configuration: %v", err)
+		}
+		if *sc.asyncUnfolding {
+			unfolder.enableAsyncUnfolding(*sc.asyncWorkers, *sc.asyncQueueSize)
+		}
 		healthService := newHealthService(&healthConfig{
 			appDesc:                    serviceDescription,
 			port:                       *sc.appPort,
@@ -51,11 +96,17 @@ func main() {
 			contentResolverHealthURI:   *sc.contentResolverHealthURI,
 			relationsResolverHealthURI: *sc.relationsResolverHealthURI,
 			producer:                   producer,
+			topicProducers:             topicProducers,
 			client:                     client,
+			writerBreaker:              writerBreaker,
+			contentResolverBreaker:     contentResolverBreaker,
+			relationsResolverBreaker:   relationsResolverBreaker,
+			extraWriters:               extraWriters,
 		})
 
 		routing := newRouting(unfolder, healthService)
 		routing.listenAndServe(*sc.appPort)
+		unfolder.drain(time.Duration(*sc.asyncDrainTimeout) * time.Second)
 	}
 	err := app.Run(os.Args)
 	if err != nil {
@@ -78,13 +129,156 @@ func setupHttpClient() *http.Client {
 	}
 }
 
-func setupMessageProducer(sc *serviceConfig, client *http.Client) producer.MessageProducer {
+func setupPolicies(sc *serviceConfig) *policy.Policies {
+	if *sc.unfoldingPoliciesFile == "" {
+		return policy.FromWhitelist(*sc.unfoldingWhitelist)
+	}
+
+	policies, err := policy.Load(*sc.unfoldingPoliciesFile)
+	if err != nil {
+		logger.Fatalf("Unable to load unfolding policies: %v", err)
+	}
+	return policies
+}
+
+func setupWriterRetryPolicy(sc *serviceConfig) fw.RetryPolicy {
+	return fw.RetryPolicy{
+		MaxAttempts:       *sc.writerRetryMaxAttempts,
+		BaseDelay:         time.Duration(*sc.writerRetryBaseDelay) * time.Millisecond,
+		Jitter:            time.Duration(*sc.writerRetryJitter) * time.Millisecond,
+		RetryableStatuses: *sc.writerRetryStatuses,
+	}
+}
+
+// setupForwarder writes to --writer-uri or the writer of the collection type, replaying its PUTs to the shadow writer if there is one,
+// and to the extra writers as well if there are any. The extra writers are returned for the health checks.
+func setupForwarder(sc *serviceConfig, client *http.Client, writerBreaker *breaker.Breaker) (fw.Forwarder, []extraWriter) {
+	if err := fw.ValidateWriterURI(*sc.writerURI); err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	uriByType, err := parseWriterURIsByType(*sc.writerURIsByType)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// the breaker wraps the retries, so that one call to the writer counts once whatever its attempts
+	primary := fw.NewBreakerForwarder(fw.NewForwarderWithOverrides(client, *sc.writerURI, uriByType, setupWriterRetryPolicy(sc)), writerBreaker)
+	if *sc.shadowWriterURI != "" {
+		if err := fw.ValidateWriterURI(*sc.shadowWriterURI); err != nil {
+			logger.Fatalf("Invalid configuration: %v", err)
+		}
+		if *sc.shadowWriterTimeout <= 0 {
+			logger.Fatalf("Invalid configuration: shadow writer timeout [%v] is not a positive number of seconds", *sc.shadowWriterTimeout)
+		}
+		candidate := fw.NewForwarder(client, *sc.shadowWriterURI)
+		primary = fw.NewShadowForwarder(primary, candidate, time.Duration(*sc.shadowWriterTimeout)*time.Second, *sc.shadowWriterMaxInFlight)
+	}
+	if len(*sc.extraWriterURIs) == 0 {
+		return primary, nil
+	}
+
+	targets := []fw.Target{{Name: *sc.writerURI, Forwarder: primary, Required: true}}
+	var extraWriters []extraWriter
+	for _, value := range *sc.extraWriterURIs {
+		uri, required, err := parseWriterTarget(value)
+		if err != nil {
+			logger.Fatalf("Invalid configuration: %v", err)
+		}
+		extraBreaker := setupBreaker(sc, uri)
+		targets = append(targets, fw.Target{
+			Name:      uri,
+			Forwarder: fw.NewBreakerForwarder(fw.NewForwarderWithRetry(client, uri, setupWriterRetryPolicy(sc)), extraBreaker),
+			Required:  required,
+		})
+		extraWriters = append(extraWriters, extraWriter{uri: uri, required: required, breaker: extraBreaker})
+	}
+
+	forwarder, err := fw.NewFanOutForwarder(targets, *sc.writerAggregation)
+	if err != nil {
+		logger.Fatalf("Invalid configuration: %v", err)
+	}
+	return forwarder, extraWriters
+}
+
+// parseWriterTarget reads an extra writer given as required=<uri> or best-effort=<uri>.
+func parseWriterTarget(value string) (string, bool, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", false, fmt.Errorf("extra writer [%v] is not given as required=<uri> or best-effort=<uri>", value)
+	}
+
+	if err := fw.ValidateWriterURI(parts[1]); err != nil {
+		return "", false, err
+	}
+
+	switch parts[0] {
+	case "required":
+		return parts[1], true, nil
+	case "best-effort":
+		return parts[1], false, nil
+	}
+	return "", false, fmt.Errorf("extra writer [%v] is neither required nor best-effort", value)
+}
+
+// parseWriterURIsByType reads the writers of collection types given as <collectionType>=<uri>.
+func parseWriterURIsByType(values []string) (map[string]string, error) {
+	uriByType := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("writer [%v] is not given as <collectionType>=<uri>", value)
+		}
+		if err := fw.ValidateWriterURI(parts[1]); err != nil {
+			return nil, err
+		}
+		uriByType[parts[0]] = parts[1]
+	}
+	return uriByType, nil
+}
+
+// setupBreaker builds the circuit breaker of the calls to one dependency.
+func setupBreaker(sc *serviceConfig, name string) *breaker.Breaker {
+	return breaker.New(name, breaker.Settings{
+		FailureThreshold: *sc.breakerFailureThreshold,
+		OpenTimeout:      time.Duration(*sc.breakerOpenTimeout) * time.Second,
+		HalfOpenProbes:   *sc.breakerHalfOpenProbes,
+	})
+}
+
+func setupIdempotencyStore(sc *serviceConfig) idempotency.Store {
+	ttl := time.Duration(*sc.idempotencyTTL) * time.Second
+	switch *sc.idempotencyStore {
+	case "none":
+		return nil
+	case "memory":
+		return idempotency.NewMemoryStore(*sc.idempotencyCapacity, ttl)
+	case "file":
+		publishes, err := idempotency.NewFileStore(*sc.idempotencyFile, *sc.idempotencyCapacity, ttl)
+		if err != nil {
+			logger.Fatalf("Unable to load idempotency store: %v", err)
+		}
+		return publishes
+	default:
+		logger.Fatalf("Invalid configuration: unknown idempotency store [%v]", *sc.idempotencyStore)
+		return nil
+	}
+}
+
+func setupMessageProducer(sc *serviceConfig, client *http.Client, topic string) producer.MessageProducer {
 	config := producer.MessageProducerConfig{
 		Addr:          *sc.kafkaAddr,
-		Topic:         *sc.writeTopic,
+		Topic:         topic,
 		Queue:         *sc.kafkaHostname,
 		Authorization: *sc.kafkaAuth,
 	}
 
 	return producer.NewMessageProducerWithHTTPClient(config, client)
 }
+
+func setupTopicProducers(sc *serviceConfig, client *http.Client, topics []string) map[string]producer.MessageProducer {
+	topicProducers := map[string]producer.MessageProducer{}
+	for _, topic := range topics {
+		topicProducers[topic] = setupMessageProducer(sc, client, topic)
+	}
+	return topicProducers
+}
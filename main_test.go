@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
@@ -8,9 +9,12 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
 	"github.com/Financial-Times/content-collection-unfolder/differ"
 	fw "github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
 	prod "github.com/Financial-Times/content-collection-unfolder/producer"
 	"github.com/Financial-Times/content-collection-unfolder/relations"
 	res "github.com/Financial-Times/content-collection-unfolder/resolver"
@@ -112,6 +116,94 @@ func TestAllHealthChecksGood(t *testing.T) {
 	}
 }
 
+func TestHealthCheckReportsOpenBreaker(t *testing.T) {
+	writerServer := startWriterServer(t, okHandler)
+	defer writerServer.Close()
+
+	contentResolverServer := startContentResolverServer(t, okHandler)
+	defer contentResolverServer.Close()
+
+	relationsResolverServer := startRelationsResolverServer(t, okHandler)
+	defer relationsResolverServer.Close()
+
+	relationsResolverBreaker := breaker.New("relations-api", breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingServer.Close()
+	resp, err := relationsResolverBreaker.Client(http.DefaultClient).Get(failingServer.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	hs := newHealthService(&healthConfig{
+		writerHealthURI:            writerServer.URL + writerHealthPath,
+		contentResolverHealthURI:   contentResolverServer.URL + contentResolverHealthPath,
+		relationsResolverHealthURI: relationsResolverServer.URL + relationsResolverHealthPath,
+		client:                     setupHttpClient(),
+		writerBreaker:              breaker.New("content-collection-rw-neo4j", breaker.Settings{}),
+		relationsResolverBreaker:   relationsResolverBreaker,
+	})
+
+	msg, err := hs.writerChecker()
+	assert.NoError(t, err)
+	assert.Equal(t, "OK. Circuit breaker [content-collection-rw-neo4j] is closed", msg)
+
+	msg, err = hs.contentResolverChecker()
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", msg)
+
+	msg, err = hs.relationsResolverChecker()
+	assert.Error(t, err)
+	assert.Contains(t, msg, "Circuit breaker [relations-api] is open")
+}
+
+func TestHealthCheckCoversTopicProducers(t *testing.T) {
+	hs := newHealthService(&healthConfig{
+		producer: &testProducer{t, true, []string{}},
+		topicProducers: map[string]producer.MessageProducer{
+			"StoryPackageEvents": &testProducer{t, false, []string{}},
+			"CuratedListEvents":  &testProducer{t, true, []string{}},
+		},
+	})
+
+	assert.Len(t, hs.checks, 6)
+	assert.Equal(t, "Message producer health check for topic [CuratedListEvents]", hs.checks[4].Name)
+	assert.Equal(t, "Message producer health check for topic [StoryPackageEvents]", hs.checks[5].Name)
+
+	_, err := hs.checks[5].Checker()
+	assert.Error(t, err)
+}
+
+func TestHealthCheckCoversExtraWriters(t *testing.T) {
+	requiredBreaker := breaker.New("required-writer", breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	bestEffortBreaker := breaker.New("best-effort-writer", breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	err := bestEffortBreaker.Do(context.Background(), func() (bool, error) {
+		return true, errors.New("writer error")
+	})
+	assert.Error(t, err)
+
+	hs := newHealthService(&healthConfig{
+		producer: &testProducer{t, true, []string{}},
+		extraWriters: []extraWriter{
+			{uri: "http://localhost:8080/__second-writer/content-collection/", required: true, breaker: requiredBreaker},
+			{uri: "http://localhost:8080/__candidate-writer/content-collection/", required: false, breaker: bestEffortBreaker},
+		},
+	})
+
+	assert.Len(t, hs.checks, 6)
+	assert.Len(t, hs.gtgChecks, 5, "a best-effort writer must not take the service out")
+
+	msg, err := hs.checks[4].Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "Circuit breaker [required-writer] is closed", msg)
+	assert.Equal(t, uint8(2), hs.checks[4].Severity)
+
+	msg, err = hs.checks[5].Checker()
+	assert.Error(t, err)
+	assert.Contains(t, msg, "Circuit breaker [best-effort-writer] is open")
+	assert.Equal(t, uint8(3), hs.checks[5].Severity)
+}
+
 func TestEndToEndFlow(t *testing.T) {
 	writerServer := startWriterServer(t, okHandler)
 	defer writerServer.Close()
@@ -137,6 +229,13 @@ func TestEndToEndFlow(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	report := unfoldingReport{}
+	assert.NoError(t, json.Unmarshal(body, &report))
+	assert.ElementsMatch(t, []string{addedItemUuid, deletedItemUuid, leadArticleUuid}, report.Sent)
+	assert.Empty(t, report.Failed)
+
 	assert.Equal(t, 3, len(messageProducer.received))
 	allMessages := strings.Join(messageProducer.received, "")
 	assert.Equal(t, 2, strings.Count(allMessages, addedItemUuid))
@@ -276,10 +375,44 @@ func startRouting(
 			fw.NewForwarder(client, writerServer.URL+strings.Split(writerPath, "/{")[0]),
 			res.NewContentResolver(client, contentResolverServer.URL+contentResolverPath, requestTimeoutInt),
 			prod.NewContentProducer(messageProducer),
-			[]string{whitelistedCollection},
+			policy.FromWhitelist([]string{whitelistedCollection}),
 		),
 		newHealthService(hc),
 	)
 
 	return routing
 }
+
+func TestParseWriterTarget(t *testing.T) {
+	uri, required, err := parseWriterTarget("required=http://localhost:8080/__second-writer/content-collection/")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/__second-writer/content-collection/", uri)
+	assert.True(t, required)
+
+	uri, required, err = parseWriterTarget("best-effort=http://localhost:8080/__candidate-writer/")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/__candidate-writer/", uri)
+	assert.False(t, required)
+
+	for _, invalid := range []string{"http://localhost:8080/__candidate-writer/", "optional=http://localhost:8080/", "required="} {
+		_, _, err = parseWriterTarget(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseWriterURIsByType(t *testing.T) {
+	uriByType, err := parseWriterURIsByType([]string{
+		"content-package=http://localhost:8080/__package-writer/{collectionType}/{uuid}",
+		"curated-list=http://localhost:8080/__list-writer/",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"content-package": "http://localhost:8080/__package-writer/{collectionType}/{uuid}",
+		"curated-list":    "http://localhost:8080/__list-writer/",
+	}, uriByType)
+
+	for _, invalid := range []string{"http://localhost:8080/__list-writer/", "=http://localhost:8080/", "curated-list=", "curated-list=http://localhost:8080/{collectionType}"} {
+		_, err = parseWriterURIsByType([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
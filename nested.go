@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Financial-Times/content-collection-unfolder/policy"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	logger "github.com/Financial-Times/go-logger"
+)
+
+// maxNestedLookups is the number of members of one level of nested collections read from relations-api at the same time.
+const maxNestedLookups = 8
+
+// memberChanges tells the producer what the update did to each member. When the policy unfolds nested collections,
+// the content that joined or left the collection through a nested collection is added to the notified uuids too.
+func (u *unfolder) memberChanges(ctx context.Context, tid string, uuid string, collectionType string, changes collectionChanges, unfoldingPolicy policy.Policy) map[string]string {
+	changesByUuid := changeTypes(changes.diff)
+	if unfoldingPolicy.NestedDepth <= 0 {
+		return changesByUuid
+	}
+
+	nested, err := u.nestedChanges(ctx, tid, uuid, changes.uuidsAndDate.UuidArr, changes.oldRelations.Contains, unfoldingPolicy.NestedDepth)
+	if err != nil {
+		logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unfolding only the direct members. Error while resolving nested collections: %v", tid, uuid, collectionType, err)
+		return changesByUuid
+	}
+
+	for nestedUuid, change := range nested {
+		changes.diffUuidsSet.Add(nestedUuid)
+		changesByUuid[nestedUuid] = change
+	}
+	return changesByUuid
+}
+
+// nestedChanges compares the content reachable through the nested collections of the incoming and the old members,
+// down to depth levels. Content that is a direct member of either is left to the diff of the collection itself.
+func (u *unfolder) nestedChanges(ctx context.Context, tid string, uuid string, incoming []string, old []string, depth int) (map[string]string, error) {
+	members := memberLookup{ctx: ctx, tid: tid, unfolder: u, cache: map[string][]string{}}
+
+	reachable, err := members.reachable(uuid, incoming, depth)
+	if err != nil {
+		return nil, err
+	}
+	reachableBefore, err := members.reachable(uuid, old, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	direct := map[string]bool{}
+	for _, member := range append(append([]string{}, incoming...), old...) {
+		direct[member] = true
+	}
+
+	nested := map[string]string{}
+	for member := range reachable {
+		if !direct[member] && !reachableBefore[member] {
+			nested[member] = prod.ChangeAdded
+		}
+	}
+	for member := range reachableBefore {
+		if !direct[member] && !reachable[member] {
+			nested[member] = prod.ChangeRemoved
+		}
+	}
+	return nested, nil
+}
+
+// memberLookup reads the members of nested collections from relations-api, once per collection.
+type memberLookup struct {
+	ctx      context.Context
+	tid      string
+	unfolder *unfolder
+	cache    map[string][]string
+}
+
+// reachable returns the content found in the nested collections among roots, down to depth levels.
+// Every collection is expanded at most once, so cycles end there, and the collection itself is never expanded.
+func (m *memberLookup) reachable(uuid string, roots []string, depth int) (map[string]bool, error) {
+	visited := map[string]bool{uuid: true}
+	for _, root := range roots {
+		visited[root] = true
+	}
+
+	found := map[string]bool{}
+	level := roots
+	for d := 0; d < depth && len(level) > 0; d++ {
+		if err := m.prefetch(level); err != nil {
+			return nil, err
+		}
+
+		var next []string
+		for _, member := range level {
+			contained, err := m.members(member)
+			if err != nil {
+				return nil, err
+			}
+			for _, nestedMember := range contained {
+				if visited[nestedMember] {
+					continue
+				}
+				visited[nestedMember] = true
+				found[nestedMember] = true
+				next = append(next, nestedMember)
+			}
+		}
+		level = next
+	}
+	return found, nil
+}
+
+// prefetch reads the members of the content not read yet, up to maxNestedLookups at a time. Most members are not
+// collections, but relations-api has to be asked to know. The first error cancels the reads still running.
+func (m *memberLookup) prefetch(uuids []string) error {
+	var missing []string
+	seen := map[string]bool{}
+	for _, uuid := range uuids {
+		if _, ok := m.cache[uuid]; !ok && !seen[uuid] {
+			seen[uuid] = true
+			missing = append(missing, uuid)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	contains := make([][]string, len(missing))
+	slots := make(chan struct{}, maxNestedLookups)
+	for i, uuid := range missing {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, uuid string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			relations, err := m.unfolder.relationsResolver.ResolveContext(ctx, uuid, m.tid)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			contains[i] = relations.Contains
+		}(i, uuid)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	for i, uuid := range missing {
+		m.cache[uuid] = contains[i]
+	}
+	return nil
+}
+
+// members returns the members of the given content, which has none unless it is a collection.
+func (m *memberLookup) members(uuid string) ([]string, error) {
+	if cached, ok := m.cache[uuid]; ok {
+		return cached, nil
+	}
+
+	relations, err := m.unfolder.relationsResolver.ResolveContext(m.ctx, uuid, m.tid)
+	if err != nil {
+		return nil, err
+	}
+	m.cache[uuid] = relations.Contains
+	return relations.Contains, nil
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	"github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const nestedTid = "tid_nested"
+
+func expectMembers(mrr *mockRelationsResolver, members map[string][]string) {
+	for uuid, contains := range members {
+		mrr.On("Resolve", uuid, nestedTid).Return(&relations.CCRelations{Contains: contains}, nil)
+	}
+}
+
+func TestNestedChanges(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+	expectMembers(mrr, map[string][]string{
+		"article":     {},
+		"new-package": {"x", "y"},
+		"old-package": {"y", "z"},
+		"x":           {},
+		"y":           {"collection"},
+		"z":           {"w"},
+		"w":           {},
+	})
+
+	nested, err := u.nestedChanges(context.Background(), nestedTid, "collection", []string{"article", "new-package"}, []string{"article", "old-package"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"x": prod.ChangeAdded, "z": prod.ChangeRemoved}, nested)
+
+	nested, err = u.nestedChanges(context.Background(), nestedTid, "collection", []string{"article", "new-package"}, []string{"article", "old-package"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"x": prod.ChangeAdded, "z": prod.ChangeRemoved, "w": prod.ChangeRemoved}, nested)
+}
+
+func TestNestedChangesSkipDirectMembersAndCycles(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+	expectMembers(mrr, map[string][]string{
+		"package": {"article", "other-package"},
+		"article": {},
+		// the nested collections contain each other
+		"other-package": {"package", "collection", "deep"},
+		"deep":          {},
+	})
+
+	nested, err := u.nestedChanges(context.Background(), nestedTid, "collection", []string{"package", "article"}, []string{"article"}, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"other-package": prod.ChangeAdded, "deep": prod.ChangeAdded}, nested)
+
+	// every collection is read from relations-api once
+	mrr.AssertNumberOfCalls(t, "Resolve", 4)
+}
+
+func TestNestedChangesReadMembersConcurrently(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+
+	var inFlight, maxInFlight int32
+	mrr.On("Resolve", mock.Anything, nestedTid).
+		Run(func(mock.Arguments) {
+			current := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for seen := atomic.LoadInt32(&maxInFlight); current > seen; seen = atomic.LoadInt32(&maxInFlight) {
+				atomic.CompareAndSwapInt32(&maxInFlight, seen, current)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}).
+		Return(&relations.CCRelations{}, nil)
+
+	incoming := make([]string, 2*maxNestedLookups)
+	for i := range incoming {
+		incoming[i] = fmt.Sprintf("article-%d", i)
+	}
+
+	nested, err := u.nestedChanges(context.Background(), nestedTid, "collection", incoming, incoming, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, nested)
+
+	assert.True(t, atomic.LoadInt32(&maxInFlight) > 1, "the members must be read concurrently")
+	assert.True(t, atomic.LoadInt32(&maxInFlight) <= maxNestedLookups, "at most maxNestedLookups members may be read at a time")
+	mrr.AssertNumberOfCalls(t, "Resolve", len(incoming))
+}
+
+func TestNestedChangesStopAtFirstError(t *testing.T) {
+	_, mrr, _, _, _, _, u := newUnfolderWithMocks()
+	mrr.On("Resolve", "package", nestedTid).Return(&relations.CCRelations{Contains: []string{"article"}}, nil)
+	mrr.On("Resolve", "broken-package", nestedTid).Return(&relations.CCRelations{}, errors.New("relations resolver error"))
+
+	_, err := u.nestedChanges(context.Background(), nestedTid, "collection", []string{"package", "broken-package"}, nil, 2)
+	assert.EqualError(t, err, "relations resolver error")
+}
+
+func TestAllOk_NestedCollections(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.policies = policy.NewPolicies(map[string]policy.Policy{
+		whitelistedCollection: {Unfold: true, NestedDepth: 1},
+	})
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid, addedItemUuid},
+		LastModified: lastModified,
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Unchanged: []string{firstExistingItemUuid}}
+	contentArr := []map[string]interface{}{{"uuid": addedItemUuid}, {"uuid": secondExistingItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", collectionUuid, tid).Return(&relations.CCRelations{Contains: []string{firstExistingItemUuid}}, nil)
+	mrr.On("Resolve", firstExistingItemUuid, tid).Return(&relations.CCRelations{}, nil)
+	// the added member is a collection itself
+	mrr.On("Resolve", addedItemUuid, tid).Return(&relations.CCRelations{Contains: []string{secondExistingItemUuid}}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(func(uuids []string) bool {
+			return assert.ElementsMatch(t, []string{addedItemUuid, secondExistingItemUuid}, uuids)
+		}),
+		mock.Anything, mock.Anything).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.Anything,
+		mock.Anything,
+		mock.Anything,
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: map[string]string{
+			addedItemUuid:          prod.ChangeAdded,
+			firstExistingItemUuid:  prod.ChangeUnchanged,
+			secondExistingItemUuid: prod.ChangeAdded,
+		}}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
+}
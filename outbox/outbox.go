@@ -0,0 +1,191 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/atomicfile"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+)
+
+const (
+	entryExtension = ".json"
+	deadLetterDir  = "dead-letter"
+)
+
+// Entry holds the notifications of one collection update that are not delivered yet.
+type Entry struct {
+	ID             string              `json:"id"`
+	Tid            string              `json:"tid"`
+	CollectionUUID string              `json:"collectionUuid"`
+	CollectionType string              `json:"collectionType"`
+	LastModified   string              `json:"lastModified"`
+	Uuids          []string            `json:"uuids"`
+	Options        prod.MessageOptions `json:"options"`
+	Attempts       int                 `json:"attempts"`
+	NextAttempt    time.Time           `json:"nextAttempt"`
+}
+
+// Outbox keeps pending notifications until they are delivered.
+type Outbox interface {
+	// Add stores a new entry and returns it with its ID set. The entry is in flight, as its first attempt is about
+	// to be made, until it is saved, removed or dead-lettered.
+	Add(entry Entry) (Entry, error)
+	// Due returns the entries whose next attempt is not after now, the most overdue first. Entries in flight are
+	// never due.
+	Due(now time.Time) []Entry
+	// Save replaces a stored entry.
+	Save(entry Entry) error
+	// Remove forgets a delivered entry.
+	Remove(id string) error
+	// DeadLetter moves an entry that is not retried any more out of the outbox, keeping it for inspection.
+	DeadLetter(entry Entry) error
+}
+
+type fileOutbox struct {
+	mutex   sync.Mutex
+	dir     string
+	entries map[string]Entry
+	// inFlight is only kept in memory: after a restart, no attempt is running any more
+	inFlight map[string]bool
+	counter  int
+}
+
+// NewFileOutbox keeps every entry in its own file in dir, so that pending notifications survive a restart.
+// The entries already in dir are loaded. Dead-lettered entries are kept in the dead-letter directory inside dir.
+func NewFileOutbox(dir string) (Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create outbox directory [%v]: %v", dir, err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read outbox directory [%v]: %v", dir, err)
+	}
+
+	o := fileOutbox{dir: dir, entries: map[string]Entry{}, inFlight: map[string]bool{}}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), entryExtension) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read outbox entry [%v]: %v", file.Name(), err)
+		}
+
+		entry := Entry{}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("unable to parse outbox entry [%v]: %v", file.Name(), err)
+		}
+		o.entries[entry.ID] = entry
+	}
+
+	return &o, nil
+}
+
+func (o *fileOutbox) Add(entry Entry) (Entry, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.counter++
+	entry.ID = fmt.Sprintf("%d-%d-%v", time.Now().UnixNano(), o.counter, entry.CollectionUUID)
+	if err := o.write(entry); err != nil {
+		return Entry{}, err
+	}
+	o.entries[entry.ID] = entry
+	o.inFlight[entry.ID] = true
+	return entry, nil
+}
+
+func (o *fileOutbox) Due(now time.Time) []Entry {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	due := []Entry{}
+	for _, entry := range o.entries {
+		if !o.inFlight[entry.ID] && !entry.NextAttempt.After(now) {
+			due = append(due, entry)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+	return due
+}
+
+func (o *fileOutbox) Save(entry Entry) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, ok := o.entries[entry.ID]; !ok {
+		return fmt.Errorf("no outbox entry with id [%v]", entry.ID)
+	}
+	// the attempt is over even if the entry cannot be written, so that the next one is made
+	delete(o.inFlight, entry.ID)
+	if err := o.write(entry); err != nil {
+		return err
+	}
+	o.entries[entry.ID] = entry
+	return nil
+}
+
+func (o *fileOutbox) Remove(id string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if err := os.Remove(o.fileName(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove outbox entry [%v]: %v", id, err)
+	}
+	delete(o.entries, id)
+	delete(o.inFlight, id)
+	return nil
+}
+
+func (o *fileOutbox) DeadLetter(entry Entry) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, ok := o.entries[entry.ID]; !ok {
+		return fmt.Errorf("no outbox entry with id [%v]", entry.ID)
+	}
+	delete(o.inFlight, entry.ID)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal outbox entry [%v]: %v", entry.ID, err)
+	}
+	deadLetters := filepath.Join(o.dir, deadLetterDir)
+	if err := os.MkdirAll(deadLetters, 0755); err != nil {
+		return fmt.Errorf("unable to create outbox dead-letter directory [%v]: %v", deadLetters, err)
+	}
+	if err := atomicfile.Write(filepath.Join(deadLetters, entry.ID+entryExtension), data); err != nil {
+		return fmt.Errorf("unable to dead-letter outbox entry [%v]: %v", entry.ID, err)
+	}
+
+	if err := os.Remove(o.fileName(entry.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove dead-lettered outbox entry [%v]: %v", entry.ID, err)
+	}
+	delete(o.entries, entry.ID)
+	return nil
+}
+
+func (o *fileOutbox) write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("unable to marshal outbox entry [%v]: %v", entry.ID, err)
+	}
+	if err := atomicfile.Write(o.fileName(entry.ID), data); err != nil {
+		return fmt.Errorf("unable to write outbox entry [%v]: %v", entry.ID, err)
+	}
+	return nil
+}
+
+func (o *fileOutbox) fileName(id string) string {
+	return filepath.Join(o.dir, id+entryExtension)
+}
@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEntry() Entry {
+	return Entry{
+		Tid:            "tid_test",
+		CollectionUUID: "45163790-eec9-11e6-abbc-ee7d9c5b3b90",
+		CollectionType: "content-package",
+		LastModified:   "2017-01-31T15:33:21.687Z",
+		Uuids:          []string{"d4986a58-de3b-11e6-86ac-f253db7791c6", "d9b4c4c6-dcc6-11e6-86ac-f253db7791c6"},
+		Options:        prod.MessageOptions{Changes: map[string]string{"d4986a58-de3b-11e6-86ac-f253db7791c6": prod.ChangeAdded}},
+	}
+}
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	return dir
+}
+
+func TestEntriesSurviveRestart(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	o, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	entry, err := o.Add(newTestEntry())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, entry.ID)
+
+	restarted, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{entry}, restarted.Due(time.Now()))
+}
+
+func TestOnlyDueEntriesAreReturned(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	o, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	later, err := o.Add(newTestEntry())
+	assert.NoError(t, err)
+	later.NextAttempt = now.Add(time.Minute)
+	assert.NoError(t, o.Save(later))
+
+	due, err := o.Add(newTestEntry())
+	assert.NoError(t, err)
+	due.NextAttempt = now.Add(-time.Minute)
+	assert.NoError(t, o.Save(due))
+
+	assert.Equal(t, []Entry{due}, o.Due(now))
+	assert.Len(t, o.Due(now.Add(2*time.Minute)), 2)
+}
+
+func TestEntriesInFlightAreNotDue(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	o, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	entry, err := o.Add(newTestEntry())
+	assert.NoError(t, err)
+	assert.Empty(t, o.Due(time.Now().Add(time.Hour)))
+
+	entry.Attempts = 1
+	assert.NoError(t, o.Save(entry))
+	assert.Equal(t, []Entry{entry}, o.Due(time.Now().Add(time.Hour)))
+}
+
+func TestDeadLetter(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	o, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	entry, err := o.Add(newTestEntry())
+	assert.NoError(t, err)
+	entry.Attempts = 3
+	assert.NoError(t, o.DeadLetter(entry))
+	assert.Empty(t, o.Due(time.Now().Add(time.Hour)))
+
+	restarted, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, restarted.Due(time.Now().Add(time.Hour)))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, deadLetterDir, entry.ID+entryExtension))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"attempts":3`)
+
+	assert.Error(t, o.DeadLetter(entry))
+}
+
+func TestSaveAndRemove(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	o, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	entry, err := o.Add(newTestEntry())
+	assert.NoError(t, err)
+
+	entry.Uuids = entry.Uuids[1:]
+	entry.Attempts = 1
+	assert.NoError(t, o.Save(entry))
+
+	restarted, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []Entry{entry}, restarted.Due(time.Now()))
+
+	assert.NoError(t, restarted.Remove(entry.ID))
+	assert.Empty(t, restarted.Due(time.Now()))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestSaveUnknownEntry(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	o, err := NewFileOutbox(dir)
+	assert.NoError(t, err)
+
+	assert.Error(t, o.Save(newTestEntry()))
+}
+
+func TestInvalidEntryFile(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644))
+
+	_, err := NewFileOutbox(dir)
+	assert.Error(t, err)
+}
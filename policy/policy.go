@@ -0,0 +1,80 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Policy describes how collections of one type are unfolded and how their members are notified.
+type Policy struct {
+	Unfold             bool   `json:"unfold"`
+	IncludeLeadArticle bool   `json:"includeLeadArticle"`
+	NotifyUnchanged    bool   `json:"notifyUnchanged"`
+	NotifyReordered    bool   `json:"notifyReordered"`
+	NestedDepth        int    `json:"nestedDepth"`
+	ContainerDepth     int    `json:"containerDepth"`
+	MessageType        string `json:"messageType"`
+	OriginSystemID     string `json:"originSystemId"`
+	Topic              string `json:"topic"`
+}
+
+// Policies holds the unfolding policy of every known collection type. Unknown types are not unfolded.
+type Policies struct {
+	byType map[string]Policy
+}
+
+func NewPolicies(byType map[string]Policy) *Policies {
+	p := Policies{byType: map[string]Policy{}}
+	for collectionType, policy := range byType {
+		p.byType[collectionType] = policy
+	}
+	return &p
+}
+
+// FromWhitelist builds the policies equivalent to the unfolding whitelist: the whitelisted types are unfolded,
+// together with their lead article, using the default message headers and topic.
+func FromWhitelist(whitelist []string) *Policies {
+	byType := map[string]Policy{}
+	for _, collectionType := range whitelist {
+		byType[collectionType] = Policy{Unfold: true, IncludeLeadArticle: true}
+	}
+	return NewPolicies(byType)
+}
+
+// Load reads the policies from a JSON file keyed by collection type.
+func Load(fileName string) (*Policies, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read unfolding policies file [%v]: %v", fileName, err)
+	}
+
+	// unknown keys are refused, so that a misspelled option does not quietly fall back to its zero value
+	byType := map[string]Policy{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&byType); err != nil {
+		return nil, fmt.Errorf("unable to parse unfolding policies file [%v]: %v", fileName, err)
+	}
+
+	return NewPolicies(byType), nil
+}
+
+func (p *Policies) For(collectionType string) Policy {
+	return p.byType[collectionType]
+}
+
+// Topics returns the distinct topics the policies send to, leaving out the default one.
+func (p *Policies) Topics() []string {
+	seen := map[string]struct{}{}
+	topics := []string{}
+	for _, policy := range p.byType {
+		if _, ok := seen[policy.Topic]; ok || policy.Topic == "" {
+			continue
+		}
+		seen[policy.Topic] = struct{}{}
+		topics = append(topics, policy.Topic)
+	}
+	return topics
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromWhitelist(t *testing.T) {
+	p := FromWhitelist([]string{"content-package"})
+
+	assert.Equal(t, Policy{Unfold: true, IncludeLeadArticle: true}, p.For("content-package"))
+	assert.Equal(t, Policy{}, p.For("story-package"))
+	assert.Empty(t, p.Topics())
+}
+
+func TestLoad(t *testing.T) {
+	p, err := Load("../test-resources/unfolding-policies.json")
+	assert.NoError(t, err)
+
+	assert.Equal(t, Policy{Unfold: true, IncludeLeadArticle: true}, p.For("content-package"))
+	assert.False(t, p.For("story-package").Unfold)
+	assert.Equal(t, Policy{
+		Unfold:          true,
+		NotifyUnchanged: true,
+		NestedDepth:     2,
+		MessageType:     "cms-content-curated",
+		OriginSystemID:  "http://cmdb.ft.com/systems/spark",
+		Topic:           "CuratedListEvents",
+	}, p.For("curated-list"))
+	assert.Equal(t, Policy{}, p.For("unknown"))
+	assert.Equal(t, []string{"CuratedListEvents"}, p.Topics())
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	_, err := Load("../test-resources/no-such-file.json")
+	assert.Error(t, err)
+}
+
+func TestLoadInvalidFile(t *testing.T) {
+	_, err := Load("../test-resources/relations-api-wrong-json-response.json")
+	assert.Error(t, err)
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policies")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "policies.json")
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte(`{"content-package": {"unfolding": true}}`), 0644))
+
+	_, err = Load(fileName)
+	assert.Error(t, err)
+}
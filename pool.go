@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/outbox"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	logger "github.com/Financial-Times/go-logger"
+)
+
+type unfoldingJob struct {
+	tid            string
+	uuid           string
+	collectionType string
+	lastModified   string
+	diffUuids      []string
+	options        prod.MessageOptions
+	pending        *outbox.Entry
+	// release lets go of the share of the collection lock the job holds, if any
+	release func()
+}
+
+// done releases the share of the collection lock held by the job.
+func (job unfoldingJob) done() {
+	if job.release != nil {
+		job.release()
+	}
+}
+
+type unfoldingPool struct {
+	jobs    chan unfoldingJob
+	work    func(job unfoldingJob)
+	mutex   sync.RWMutex
+	closed  bool
+	workers sync.WaitGroup
+}
+
+func newUnfoldingPool(workers int, queueSize int, work func(job unfoldingJob)) *unfoldingPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := unfoldingPool{
+		jobs: make(chan unfoldingJob, queueSize),
+		work: work,
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+
+	return &p
+}
+
+// submit queues the job without blocking. It returns false if the queue is full or the pool is draining.
+func (p *unfoldingPool) submit(job unfoldingJob) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain stops accepting jobs and waits for the queued ones to be processed, up to the given timeout.
+func (p *unfoldingPool) drain(timeout time.Duration) bool {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		logger.Warnf("Unfolding pool drain timed out after %v. Jobs left in queue: %v", timeout, len(p.jobs))
+		return false
+	}
+}
+
+func (p *unfoldingPool) run() {
+	defer p.workers.Done()
+	for job := range p.jobs {
+		p.work(job)
+	}
+}
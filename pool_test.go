@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolProcessesAllJobsBeforeDrainReturns(t *testing.T) {
+	var mutex sync.Mutex
+	var processed []string
+
+	p := newUnfoldingPool(2, 10, func(job unfoldingJob) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		processed = append(processed, job.uuid)
+	})
+
+	assert.True(t, p.submit(unfoldingJob{uuid: firstExistingItemUuid}))
+	assert.True(t, p.submit(unfoldingJob{uuid: secondExistingItemUuid}))
+	assert.True(t, p.submit(unfoldingJob{uuid: addedItemUuid}))
+
+	assert.True(t, p.drain(time.Second))
+	assert.ElementsMatch(t, []string{firstExistingItemUuid, secondExistingItemUuid, addedItemUuid}, processed)
+}
+
+func TestPoolRejectsJobsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	p := newUnfoldingPool(1, 1, func(job unfoldingJob) {
+		started <- struct{}{}
+		<-release
+	})
+
+	assert.True(t, p.submit(unfoldingJob{uuid: firstExistingItemUuid}))
+	<-started
+	assert.True(t, p.submit(unfoldingJob{uuid: secondExistingItemUuid}))
+	assert.False(t, p.submit(unfoldingJob{uuid: addedItemUuid}))
+
+	close(release)
+	go func() {
+		for range started {
+		}
+	}()
+	assert.True(t, p.drain(time.Second))
+}
+
+func TestPoolRejectsJobsAfterDrain(t *testing.T) {
+	p := newUnfoldingPool(1, 1, func(job unfoldingJob) {})
+
+	assert.True(t, p.drain(time.Second))
+	assert.False(t, p.submit(unfoldingJob{uuid: firstExistingItemUuid}))
+}
+
+func TestPoolDrainTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	p := newUnfoldingPool(1, 1, func(job unfoldingJob) {
+		<-release
+	})
+
+	assert.True(t, p.submit(unfoldingJob{uuid: firstExistingItemUuid}))
+	assert.False(t, p.drain(10*time.Millisecond))
+}
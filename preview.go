@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	logger "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/transactionid-utils-go"
+)
+
+const (
+	previewPath = unfolderPath + "/preview"
+)
+
+type previewResponse struct {
+	Added       []string         `json:"added"`
+	Removed     []string         `json:"removed"`
+	Moved       []differ.Move    `json:"moved"`
+	LeadArticle string           `json:"leadArticle,omitempty"`
+	Unfolding   bool             `json:"unfolding"`
+	Messages    []previewMessage `json:"messages"`
+}
+
+type previewMessage struct {
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// handlePreview reports what a PUT of the given collection would notify, without writing it or sending anything to Kafka.
+func (u *unfolder) handlePreview(writer http.ResponseWriter, req *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	uuid, collectionType := extractPathVariables(req)
+
+	writer.Header().Add(transactionidutils.TransactionIDHeader, tid)
+	writer.Header().Add("Content-Type", "application/json;charset=utf-8")
+
+	if err := validateCollectionUuid(tid, uuid, collectionType); err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	body, ok := readBody(writer, req, tid, uuid, collectionType)
+	if !ok {
+		return
+	}
+
+	collection := u.parseCollection(uuid, body)
+	if err := u.validateCollection(tid, uuid, collectionType, collection); err != nil {
+		writePutError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := u.withDeadline(req.Context())
+	defer cancel()
+
+	changes, err := u.resolveChanges(ctx, tid, uuid, collectionType, collection)
+	if err != nil {
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	unfoldingPolicy := u.policies.For(collectionType)
+	if isForced(req) {
+		unfoldingPolicy = forcedPolicy(unfoldingPolicy)
+	}
+	preview := previewResponse{
+		Added:       changes.diff.Added,
+		Removed:     changes.diff.Removed,
+		Moved:       changes.diff.Moved,
+		LeadArticle: changes.oldRelations.ContainedIn,
+		Unfolding:   unfoldingPolicy.Unfold,
+		Messages:    []previewMessage{},
+	}
+
+	if !preview.Unfolding {
+		writePreview(writer, preview)
+		return
+	}
+
+	changesByUuid := u.memberChanges(ctx, tid, uuid, collectionType, changes, unfoldingPolicy)
+	containers := u.containerChain(ctx, tid, uuid, collectionType, changes.oldRelations.ContainedIn, changes.diffUuidsSet.Len() > 0, unfoldingPolicy)
+	notifiedUuids := notificationUuids(changes, unfoldingPolicy, containers)
+	if len(notifiedUuids) == 0 {
+		writePreview(writer, preview)
+		return
+	}
+
+	requestTimeout := u.contentRes.GetRequestTimeout()
+	resolvedContentArr, err := u.contentRes.ResolveContentsContext(ctx, notifiedUuids, tid, requestTimeout)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while resolving contents for preview: %v", tid, uuid, collectionType, err)
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	for _, msg := range u.producer.BuildMessages(tid, changes.uuidsAndDate.LastModified, resolvedContentArr, messageOptions(unfoldingPolicy, changesByUuid)) {
+		preview.Messages = append(preview.Messages, previewMessage{Headers: msg.Headers, Body: json.RawMessage(msg.Body)})
+	}
+
+	writePreview(writer, preview)
+}
+
+func writePreview(writer http.ResponseWriter, preview previewResponse) {
+	jsonResp, err := json.Marshal(preview)
+	if err != nil {
+		logger.Errorf("Error during json marshalling of preview: %v", err)
+		writeError(writer, http.StatusInternalServerError, fmt.Errorf("unable to marshal preview: %v", err))
+		return
+	}
+
+	writeResponse(writer, http.StatusOK, jsonResp)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/message-queue-go-producer/producer"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPreview_AllOk(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid, secondExistingItemUuid, addedItemUuid},
+		LastModified: lastModified,
+	}
+	oldRelations := relations.CCRelations{
+		ContainedIn: leadArticleUuid,
+		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
+
+	contentArr := []map[string]interface{}{
+		{"uuid": addedItemUuid},
+		{"uuid": deletedItemUuid},
+		{"uuid": leadArticleUuid},
+	}
+	msgs := []producer.Message{
+		{Headers: map[string]string{"Message-Type": "cms-content-published"}, Body: `{"contentUri":"` + addedItemUuid + `"}`},
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := readTestFile(t, inputFile)
+	req := buildPreviewRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&oldRelations, nil)
+	mcd.On("Diff",
+		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
+		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
+		Return(diff)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(func(actualDiffUuids []string) bool {
+			assert.ElementsMatch(t, []string{addedItemUuid, deletedItemUuid, leadArticleUuid}, actualDiffUuids)
+			return true
+		}),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("BuildMessages",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, lastModified)),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: changeTypes(diff)}))).
+		Return(msgs)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	preview := previewResponse{}
+	assert.NoError(t, json.Unmarshal(respBody, &preview))
+	assert.Equal(t, []string{addedItemUuid}, preview.Added)
+	assert.Equal(t, []string{deletedItemUuid}, preview.Removed)
+	assert.Equal(t, leadArticleUuid, preview.LeadArticle)
+	assert.True(t, preview.Unfolding)
+	assert.Equal(t, 1, len(preview.Messages))
+	assert.Equal(t, msgs[0].Headers, preview.Messages[0].Headers)
+	assert.JSONEq(t, msgs[0].Body, string(preview.Messages[0].Body))
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mcr, mcp)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPreview_NotWhitelistedCollectionType(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid, addedItemUuid},
+		LastModified: lastModified,
+	}
+	oldRelations := relations.CCRelations{
+		Contains: []string{firstExistingItemUuid},
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := readTestFile(t, inputFile)
+	req := buildPreviewRequest(t, server.URL, ignoredCollection, collectionUuid, body, tid)
+
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&oldRelations, nil)
+	mcd.On("Diff",
+		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
+		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
+		Return(diff)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	preview := previewResponse{}
+	assert.NoError(t, json.Unmarshal(respBody, &preview))
+	assert.Equal(t, []string{addedItemUuid}, preview.Added)
+	assert.Empty(t, preview.Removed)
+	assert.False(t, preview.Unfolding)
+	assert.Empty(t, preview.Messages)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "BuildMessages", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
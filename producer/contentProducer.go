@@ -1,8 +1,11 @@
 package producer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 
 	logger "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/message-queue-go-producer/producer"
@@ -14,46 +17,156 @@ const (
 	uriBase             = "http://content-collection-unfolder.svc.ft.com/content/"
 	cmsContentPublished = "cms-content-published"
 	methodeSystemOrigin = "http://cmdb.ft.com/systems/methode-web-pub"
+	collectionChange    = "Collection-Change"
+)
+
+// The values of the Collection-Change header, telling what the collection update did to the content.
+const (
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeUnchanged = "unchanged"
+	ChangeMoved     = "moved"
 )
 
 type ContentProducer interface {
-	Send(tid string, lastModified string, contents []map[string]interface{})
+	Send(tid string, lastModified string, contents []map[string]interface{}, opts MessageOptions) ([]SendOutcome, error)
+	// SendContext works like Send, but stops sending once ctx is done. The contents left are reported as failed.
+	SendContext(ctx context.Context, tid string, lastModified string, contents []map[string]interface{}, opts MessageOptions) ([]SendOutcome, error)
+	BuildMessages(tid string, lastModified string, contents []map[string]interface{}, opts MessageOptions) []producer.Message
+}
+
+// MessageOptions overrides the Message-Type and Origin-System-Id headers and the topic of the messages.
+// Empty fields keep the defaults. Changes maps content UUIDs to the value of their Collection-Change header;
+// contents without an entry get no such header.
+type MessageOptions struct {
+	MessageType    string
+	OriginSystemID string
+	Topic          string
+	Changes        map[string]string
+}
+
+// SendOutcome tells whether the message for the content with the given UUID made it to Kafka. Err is nil on success.
+type SendOutcome struct {
+	UUID string
+	Err  error
+}
+
+// SendError aggregates the messages of a Send call that could not be placed on Kafka.
+type SendError struct {
+	Failed []SendOutcome
+	Total  int
+}
+
+func (e *SendError) Error() string {
+	reasons := make([]string, len(e.Failed))
+	for i, outcome := range e.Failed {
+		reasons[i] = fmt.Sprintf("%v: %v", outcome.UUID, outcome.Err)
+	}
+	return fmt.Sprintf("%d of %d messages could not be sent to Kafka [%v]", len(e.Failed), e.Total, strings.Join(reasons, "; "))
 }
 
 type defaultContentProducer struct {
-	msgProducer producer.MessageProducer
+	msgProducer    producer.MessageProducer
+	topicProducers map[string]producer.MessageProducer
 }
 
 func NewContentProducer(msgProducer producer.MessageProducer) ContentProducer {
+	return NewContentProducerWithTopics(msgProducer, map[string]producer.MessageProducer{})
+}
+
+// NewContentProducerWithTopics sends messages without a topic through msgProducer and the others through the producer of their topic.
+func NewContentProducerWithTopics(msgProducer producer.MessageProducer, topicProducers map[string]producer.MessageProducer) ContentProducer {
 	return &defaultContentProducer{
-		msgProducer: msgProducer,
+		msgProducer:    msgProducer,
+		topicProducers: topicProducers,
+	}
+}
+
+// Send places a message on Kafka for each content and returns the outcome for every content that had a valid UUID.
+// If any of the messages failed, a *SendError is returned as well.
+func (p *defaultContentProducer) Send(tid string, lastModified string, contents []map[string]interface{}, opts MessageOptions) ([]SendOutcome, error) {
+	return p.SendContext(context.Background(), tid, lastModified, contents, opts)
+}
+
+func (p *defaultContentProducer) SendContext(ctx context.Context, tid string, lastModified string, contents []map[string]interface{}, opts MessageOptions) ([]SendOutcome, error) {
+	outcomes := []SendOutcome{}
+	var failed []SendOutcome
+	for _, content := range contents {
+		logEntry := logger.WithField("tid", tid)
+		uuid, err := extractUuid(content)
+		if err != nil {
+			logEntry.Warnf("Skip creation of kafka message. Reason: %v", err)
+			continue
+		}
+
+		outcome := SendOutcome{UUID: uuid, Err: ctx.Err()}
+		if outcome.Err == nil {
+			outcome.Err = p.sendSingleMessage(tid, uuid, content, lastModified, opts)
+		}
+		if outcome.Err != nil {
+			failed = append(failed, outcome)
+		}
+		outcomes = append(outcomes, outcome)
+	}
+
+	if len(failed) > 0 {
+		return outcomes, &SendError{Failed: failed, Total: len(outcomes)}
 	}
+	return outcomes, nil
 }
 
-func (p *defaultContentProducer) Send(tid string, lastModified string, contents []map[string]interface{}) {
+// BuildMessages returns the messages Send would place on Kafka for the given contents, without sending them.
+func (p *defaultContentProducer) BuildMessages(tid string, lastModified string, contents []map[string]interface{}, opts MessageOptions) []producer.Message {
+	msgs := []producer.Message{}
 	for _, content := range contents {
 		logEntry := logger.WithField("tid", tid)
 		uuid, err := extractUuid(content)
 		if err != nil {
 			logEntry.Warnf("Skip creation of kafka message. Reason: %v", err)
-		} else {
-			p.sendSingleMessage(tid, uuid, content, lastModified)
+			continue
+		}
+
+		msg, err := buildMessage(tid, uuid, lastModified, content, opts)
+		if err != nil {
+			logEntry.WithField("uuid", uuid).Warnf("Skip creation of kafka message. Reason: %v", err)
+			continue
 		}
+		msgs = append(msgs, *msg)
 	}
+	return msgs
 }
 
-func (p *defaultContentProducer) sendSingleMessage(tid string, uuid string, content map[string]interface{}, lastModified string) {
+func (p *defaultContentProducer) sendSingleMessage(tid string, uuid string, content map[string]interface{}, lastModified string, opts MessageOptions) error {
 	logEntry := logger.WithField("tid", tid).WithField("uuid", uuid)
-	msg, err := buildMessage(tid, uuid, lastModified, content)
+	msgProducer, err := p.producerFor(opts.Topic)
 	if err != nil {
 		logEntry.Warnf("Skip creation of kafka message. Reason: %v", err)
-		return
+		return err
 	}
 
-	err = p.msgProducer.SendMessage("", *msg)
+	msg, err := buildMessage(tid, uuid, lastModified, content, opts)
+	if err != nil {
+		logEntry.Warnf("Skip creation of kafka message. Reason: %v", err)
+		return err
+	}
+
+	err = msgProducer.SendMessage("", *msg)
 	if err != nil {
 		logEntry.Warnf("Unable to send message to Kafka. Reason: %v", err)
 	}
+	return err
+}
+
+func (p *defaultContentProducer) producerFor(topic string) (producer.MessageProducer, error) {
+	if topic == "" {
+		return p.msgProducer, nil
+	}
+
+	msgProducer, ok := p.topicProducers[topic]
+	if !ok {
+		return nil, fmt.Errorf("No producer configured for topic %v", topic)
+	}
+	return msgProducer, nil
 }
 
 func extractUuid(content map[string]interface{}) (string, error) {
@@ -75,7 +188,7 @@ func extractUuid(content map[string]interface{}) (string, error) {
 	return uuid, nil
 }
 
-func buildMessage(tid string, uuid string, lastModified string, content map[string]interface{}) (*producer.Message, error) {
+func buildMessage(tid string, uuid string, lastModified string, content map[string]interface{}, opts MessageOptions) (*producer.Message, error) {
 	body := publicationMessageBody{
 		ContentURI:   uriBase + uuid,
 		LastModified: lastModified,
@@ -95,6 +208,15 @@ func buildMessage(tid string, uuid string, lastModified string, content map[stri
 		"Origin-System-Id":  methodeSystemOrigin,
 		"Content-Type":      "application/json",
 	}
+	if opts.MessageType != "" {
+		headers["Message-Type"] = opts.MessageType
+	}
+	if opts.OriginSystemID != "" {
+		headers["Origin-System-Id"] = opts.OriginSystemID
+	}
+	if change, ok := opts.Changes[uuid]; ok {
+		headers[collectionChange] = change
+	}
 
 	return &producer.Message{Headers: headers, Body: *bodyAsString}, nil
 
@@ -1,8 +1,10 @@
 package producer
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,8 +29,10 @@ func TestHeadersAndBodyAreOk(t *testing.T) {
 	uuid := gouuid.NewV4().String()
 	contentArr := map[string]interface{}{"uuid": uuid}
 
-	cp.Send(tid, lastModified, []map[string]interface{}{contentArr})
+	outcomes, err := cp.Send(tid, lastModified, []map[string]interface{}{contentArr}, MessageOptions{})
 
+	assert.NoError(t, err)
+	assert.Equal(t, []SendOutcome{{UUID: uuid}}, outcomes)
 	mp.AssertCalled(t, "SendMessage",
 		mock.MatchedBy(func(key string) bool {
 			assert.Equal(t, "", key)
@@ -65,8 +69,10 @@ func TestEmptyUuidsArrSkips(t *testing.T) {
 	lastModified := time.Now().Format(timeFormat)
 	var contentsArr []map[string]interface{}
 
-	cp.Send(tid, lastModified, contentsArr)
+	outcomes, err := cp.Send(tid, lastModified, contentsArr, MessageOptions{})
 
+	assert.NoError(t, err)
+	assert.Empty(t, outcomes)
 	mp.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
 }
 
@@ -88,7 +94,7 @@ func TestMultipleMessagesHaveDifferentIds(t *testing.T) {
 
 	cp.Send(transactionidutils.NewTransactionID(),
 		time.Now().Format(timeFormat),
-		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}})
+		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}}, MessageOptions{})
 
 	mp.AssertNumberOfCalls(t, "SendMessage", 2)
 
@@ -96,14 +102,39 @@ func TestMultipleMessagesHaveDifferentIds(t *testing.T) {
 	assert.NotEqual(t, headerIds[0], headerIds[1])
 }
 
+func TestPartialFailureIsAggregated(t *testing.T) {
+	uuid1 := gouuid.NewV4().String()
+	uuid2 := gouuid.NewV4().String()
+
+	mp := new(mockProducer)
+	mp.On("SendMessage", mock.AnythingOfType("string"), mock.MatchedBy(func(msg producer.Message) bool {
+		return strings.Contains(msg.Body, uuid1)
+	})).Return(nil)
+	mp.On("SendMessage", mock.AnythingOfType("string"), mock.MatchedBy(func(msg producer.Message) bool {
+		return strings.Contains(msg.Body, uuid2)
+	})).Return(errors.New("Test error"))
+
+	cp := NewContentProducer(mp)
+
+	outcomes, err := cp.Send(transactionidutils.NewTransactionID(),
+		time.Now().Format(timeFormat),
+		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}}, MessageOptions{})
+
+	assert.Equal(t, []SendOutcome{{UUID: uuid1}, {UUID: uuid2, Err: errors.New("Test error")}}, outcomes)
+	assert.EqualError(t, err, "1 of 2 messages could not be sent to Kafka ["+uuid2+": Test error]")
+}
+
 func TestFailedUuidExtractionCausesSkip(t *testing.T) {
 	mp := new(mockProducer)
 
 	cp := NewContentProducer(mp)
 
-	cp.Send(transactionidutils.NewTransactionID(),
+	outcomes, err := cp.Send(transactionidutils.NewTransactionID(),
 		time.Now().Format(timeFormat),
-		[]map[string]interface{}{{}, {"uuid": 123}, {"uuid": "1234"}})
+		[]map[string]interface{}{{}, {"uuid": 123}, {"uuid": "1234"}}, MessageOptions{})
+
+	assert.NoError(t, err)
+	assert.Empty(t, outcomes)
 
 	mp.AssertNotCalled(t, "SendMessage", mock.AnythingOfType("string"), mock.AnythingOfType("producer.Message"))
 }
@@ -119,12 +150,21 @@ func TestSendFailureDoesNotStopProducer(t *testing.T) {
 
 	cp.Send(transactionidutils.NewTransactionID(),
 		time.Now().Format(timeFormat),
-		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}})
-	cp.Send(transactionidutils.NewTransactionID(),
+		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}}, MessageOptions{})
+	outcomes, err := cp.Send(transactionidutils.NewTransactionID(),
 		time.Now().Format(timeFormat),
-		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}})
+		[]map[string]interface{}{{"uuid": uuid1}, {"uuid": uuid2}}, MessageOptions{})
 
 	mp.AssertNumberOfCalls(t, "SendMessage", 4)
+	assert.Equal(t, 2, len(outcomes))
+	for _, outcome := range outcomes {
+		assert.Error(t, outcome.Err)
+	}
+
+	sendErr, ok := err.(*SendError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, sendErr.Total)
+	assert.Equal(t, 2, len(sendErr.Failed))
 }
 
 func TestMarshallErrorsCauseSkip(t *testing.T) {
@@ -134,13 +174,105 @@ func TestMarshallErrorsCauseSkip(t *testing.T) {
 
 	uuid1 := gouuid.NewV4().String()
 
-	cp.Send(transactionidutils.NewTransactionID(),
+	outcomes, err := cp.Send(transactionidutils.NewTransactionID(),
 		time.Now().Format(timeFormat),
-		[]map[string]interface{}{{"uuid": uuid1, "dude, what?": func() {}}})
+		[]map[string]interface{}{{"uuid": uuid1, "dude, what?": func() {}}}, MessageOptions{})
+
+	assert.Error(t, err)
+
+	assert.Equal(t, 1, len(outcomes))
+	assert.Equal(t, uuid1, outcomes[0].UUID)
+	assert.Error(t, outcomes[0].Err)
 
 	mp.AssertNotCalled(t, "SendMessage", mock.AnythingOfType("string"), mock.AnythingOfType("producer.Message"))
 }
 
+func TestBuildMessagesDoesNotSend(t *testing.T) {
+	mp := new(mockProducer)
+
+	cp := NewContentProducer(mp)
+
+	tid := transactionidutils.NewTransactionID()
+	lastModified := time.Now().Format(timeFormat)
+	uuid := gouuid.NewV4().String()
+
+	msgs := cp.BuildMessages(tid, lastModified, []map[string]interface{}{{"uuid": uuid}, {"uuid": "1234"}}, MessageOptions{})
+
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, tid, msgs[0].Headers["X-Request-Id"])
+	assert.Equal(t, lastModified, msgs[0].Headers["Message-Timestamp"])
+	assert.Equal(t, cmsContentPublished, msgs[0].Headers["Message-Type"])
+	assert.Equal(t, uriBase+uuid, unmarshall(msgs[0].Body)["contentUri"])
+	mp.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
+}
+
+func TestMessageOptionsOverrideHeaders(t *testing.T) {
+	mp := new(mockProducer)
+	mp.On("SendMessage", mock.AnythingOfType("string"), mock.AnythingOfType("producer.Message")).Return(nil)
+
+	cp := NewContentProducer(mp)
+	opts := MessageOptions{MessageType: "cms-content-curated", OriginSystemID: "http://cmdb.ft.com/systems/spark"}
+
+	_, err := cp.Send(transactionidutils.NewTransactionID(),
+		time.Now().Format(timeFormat),
+		[]map[string]interface{}{{"uuid": gouuid.NewV4().String()}}, opts)
+
+	assert.NoError(t, err)
+	mp.AssertCalled(t, "SendMessage", mock.Anything, mock.MatchedBy(func(msg producer.Message) bool {
+		assert.Equal(t, opts.MessageType, msg.Headers["Message-Type"])
+		assert.Equal(t, opts.OriginSystemID, msg.Headers["Origin-System-Id"])
+		return true
+	}))
+}
+
+func TestChangeHeader(t *testing.T) {
+	cp := NewContentProducer(new(mockProducer))
+	addedUuid := gouuid.NewV4().String()
+	removedUuid := gouuid.NewV4().String()
+	leadArticleUuid := gouuid.NewV4().String()
+	opts := MessageOptions{Changes: map[string]string{addedUuid: ChangeAdded, removedUuid: ChangeRemoved}}
+
+	msgs := cp.BuildMessages(transactionidutils.NewTransactionID(),
+		time.Now().Format(timeFormat),
+		[]map[string]interface{}{{"uuid": addedUuid}, {"uuid": removedUuid}, {"uuid": leadArticleUuid}}, opts)
+
+	assert.Len(t, msgs, 3)
+	assert.Equal(t, ChangeAdded, msgs[0].Headers["Collection-Change"])
+	assert.Equal(t, ChangeRemoved, msgs[1].Headers["Collection-Change"])
+	_, found := msgs[2].Headers["Collection-Change"]
+	assert.False(t, found)
+}
+
+func TestTopicSelectsProducer(t *testing.T) {
+	defaultProducer := new(mockProducer)
+	topicProducer := new(mockProducer)
+	topicProducer.On("SendMessage", mock.AnythingOfType("string"), mock.AnythingOfType("producer.Message")).Return(nil)
+
+	cp := NewContentProducerWithTopics(defaultProducer, map[string]producer.MessageProducer{"CuratedListEvents": topicProducer})
+
+	_, err := cp.Send(transactionidutils.NewTransactionID(),
+		time.Now().Format(timeFormat),
+		[]map[string]interface{}{{"uuid": gouuid.NewV4().String()}}, MessageOptions{Topic: "CuratedListEvents"})
+
+	assert.NoError(t, err)
+	topicProducer.AssertNumberOfCalls(t, "SendMessage", 1)
+	defaultProducer.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
+}
+
+func TestUnknownTopicFails(t *testing.T) {
+	mp := new(mockProducer)
+
+	cp := NewContentProducer(mp)
+
+	outcomes, err := cp.Send(transactionidutils.NewTransactionID(),
+		time.Now().Format(timeFormat),
+		[]map[string]interface{}{{"uuid": gouuid.NewV4().String()}}, MessageOptions{Topic: "UnknownEvents"})
+
+	assert.Error(t, err)
+	assert.Error(t, outcomes[0].Err)
+	mp.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
+}
+
 func unmarshall(jsonString string) map[string]interface{} {
 	var u map[string]interface{}
 	json.Unmarshal([]byte(jsonString), &u)
@@ -160,3 +292,18 @@ func (mp *mockProducer) ConnectivityCheck() (string, error) {
 	args := mp.Called()
 	return args.String(0), args.Error(1)
 }
+
+func TestSendStopsWhenCancelled(t *testing.T) {
+	mp := new(mockProducer)
+	cp := NewContentProducer(mp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	uuid := gouuid.NewV4().String()
+	outcomes, err := cp.SendContext(ctx, transactionidutils.NewTransactionID(), time.Now().Format(timeFormat), []map[string]interface{}{{"uuid": uuid}}, MessageOptions{})
+
+	assert.Error(t, err)
+	assert.Equal(t, []SendOutcome{{UUID: uuid, Err: context.Canceled}}, outcomes)
+	mp.AssertNotCalled(t, "SendMessage", mock.Anything, mock.Anything)
+}
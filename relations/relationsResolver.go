@@ -1,6 +1,7 @@
 package relations
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -12,6 +13,8 @@ import (
 
 type RelationsResolver interface {
 	Resolve(contentCollectionUUID string, tid string) (*CCRelations, error)
+	// ResolveContext aborts the call to relations-api once ctx is done.
+	ResolveContext(ctx context.Context, contentCollectionUUID string, tid string) (*CCRelations, error)
 }
 
 type defaultRelationsResolver struct {
@@ -24,11 +27,15 @@ func NewDefaultRelationsResolver(httpClient *http.Client, relationsApiPlaceholde
 }
 
 func (drr *defaultRelationsResolver) Resolve(contentCollectionUUID string, tid string) (*CCRelations, error) {
+	return drr.ResolveContext(context.Background(), contentCollectionUUID, tid)
+}
+
+func (drr *defaultRelationsResolver) ResolveContext(ctx context.Context, contentCollectionUUID string, tid string) (*CCRelations, error) {
 	completeUri := strings.Replace(drr.relationsApiPlaceholderUri, "{uuid}", contentCollectionUUID, 1)
 
-	resp, err := drr.callRelationsResolverApp(contentCollectionUUID, completeUri, tid)
+	resp, err := drr.callRelationsResolverApp(ctx, completeUri, tid)
 	if err != nil {
-		return nil, fmt.Errorf("Error calling on url [%v] for relations, error was: [%v]", completeUri, err.Error())
+		return nil, fmt.Errorf("Error calling on url [%v] for relations, error was: [%w]", completeUri, err)
 	}
 	defer resp.Body.Close()
 
@@ -54,7 +61,7 @@ func (drr *defaultRelationsResolver) Resolve(contentCollectionUUID string, tid s
 	return &rel, nil
 }
 
-func (drr *defaultRelationsResolver) callRelationsResolverApp(contentCollectionUUID string, completeUri string, tid string) (*http.Response, error) {
+func (drr *defaultRelationsResolver) callRelationsResolverApp(ctx context.Context, completeUri string, tid string) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodGet, completeUri, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating request to uri=[%v], transaction_id=[%v].", completeUri, tid)
@@ -64,9 +71,9 @@ func (drr *defaultRelationsResolver) callRelationsResolverApp(contentCollectionU
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "UPP content-collection-unfolder")
 
-	resp, err := drr.httpClient.Do(req)
+	resp, err := drr.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("Error doing request to uri=[%v], transaction_id=[%v].", completeUri, tid)
+		return nil, fmt.Errorf("Error doing request to uri=[%v], transaction_id=[%v]: %w", completeUri, tid, err)
 	}
 
 	return resp, nil
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	logger "github.com/Financial-Times/go-logger"
+)
+
+const (
+	unfoldingDone    = "done"
+	unfoldingQueued  = "queued"
+	unfoldingSkipped = "skipped"
+	unfoldingNoop    = "nothing-to-unfold"
+)
+
+// unfoldingReport tells the client what happened to a collection after the writer accepted it.
+type unfoldingReport struct {
+	WriterStatus int             `json:"writerStatus,omitempty"`
+	Unfolding    string          `json:"unfolding"`
+	Forced       bool            `json:"forced,omitempty"`
+	Added        []string        `json:"added"`
+	Removed      []string        `json:"removed"`
+	Moved        []differ.Move   `json:"moved"`
+	LeadArticle  string          `json:"leadArticle,omitempty"`
+	Resolved     []string        `json:"resolved"`
+	Sent         []string        `json:"sent"`
+	Failed       []failedMessage `json:"failed"`
+	// replayed marks the reports answered from the idempotency store
+	replayed bool
+}
+
+type failedMessage struct {
+	UUID   string `json:"uuid"`
+	Reason string `json:"reason"`
+}
+
+func newUnfoldingReport(writerStatus int, changes collectionChanges) *unfoldingReport {
+	return &unfoldingReport{
+		WriterStatus: writerStatus,
+		Added:        changes.diff.Added,
+		Removed:      changes.diff.Removed,
+		Moved:        changes.diff.Moved,
+		LeadArticle:  changes.oldRelations.ContainedIn,
+		Resolved:     []string{},
+		Sent:         []string{},
+		Failed:       []failedMessage{},
+	}
+}
+
+// newDeleteReport reports the former members of a deleted collection as removed.
+func newDeleteReport(writerStatus int, oldRelations *relations.CCRelations) *unfoldingReport {
+	diff := differ.CollectionDiff{Added: []string{}, Removed: append([]string{}, oldRelations.Contains...), Moved: []differ.Move{}}
+	return newUnfoldingReport(writerStatus, collectionChanges{oldRelations: oldRelations, diff: diff})
+}
+
+func (r *unfoldingReport) addResult(result unfoldingResult) {
+	r.Resolved = append(r.Resolved, result.resolved...)
+	for _, outcome := range result.outcomes {
+		if outcome.Err != nil {
+			r.Failed = append(r.Failed, failedMessage{UUID: outcome.UUID, Reason: outcome.Err.Error()})
+		} else {
+			r.Sent = append(r.Sent, outcome.UUID)
+		}
+	}
+}
+
+type unfoldingResult struct {
+	resolved []string
+	outcomes []prod.SendOutcome
+	sendErr  error
+}
+
+func newUnfoldingResult(contents []map[string]interface{}, outcomes []prod.SendOutcome) unfoldingResult {
+	result := unfoldingResult{resolved: []string{}, outcomes: outcomes}
+	for _, content := range contents {
+		if uuid, ok := content["uuid"].(string); ok {
+			result.resolved = append(result.resolved, uuid)
+		}
+	}
+	return result
+}
+
+// writeReport answers with the report, or with a 500 if it could not be marshalled.
+func writeReport(writer http.ResponseWriter, status int, report *unfoldingReport) {
+	jsonResp, err := json.Marshal(report)
+	if err != nil {
+		logger.Errorf("Error during json marshalling of unfolding report: %v", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResponse(writer, status, jsonResp)
+}
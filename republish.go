@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/content-collection-unfolder/differ"
+	res "github.com/Financial-Times/content-collection-unfolder/resolver"
+	logger "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/transactionid-utils-go"
+)
+
+const (
+	republishPath = unfolderPath + "/republish"
+)
+
+// handleRepublish notifies every current member of the collection and its lead article again, without writing anything.
+func (u *unfolder) handleRepublish(writer http.ResponseWriter, req *http.Request) {
+	tid := transactionidutils.GetTransactionIDFromRequest(req)
+	uuid, collectionType := extractPathVariables(req)
+
+	writer.Header().Add(transactionidutils.TransactionIDHeader, tid)
+	writer.Header().Add("Content-Type", "application/json;charset=utf-8")
+
+	if err := validateCollectionUuid(tid, uuid, collectionType); err != nil {
+		writeError(writer, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx, cancel := u.withDeadline(req.Context())
+	defer cancel()
+
+	lock, err := u.lockCollection(tid, uuid, collectionType)
+	if err != nil {
+		writeError(writer, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer lock.release()
+
+	currentRelations, err := u.relationsResolver.ResolveContext(ctx, uuid, tid)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while fetching collection relations: %v", tid, uuid, collectionType, err)
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	members := differ.CollectionDiff{Added: []string{}, Removed: []string{}, Unchanged: currentRelations.Contains, Moved: []differ.Move{}}
+	report := newUnfoldingReport(0, collectionChanges{oldRelations: currentRelations, diff: members})
+
+	unfoldingPolicy := u.policies.For(collectionType)
+	if !unfoldingPolicy.Unfold {
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip republishing. Collection type [%v] is not unfolded by policy", tid, uuid, collectionType, collectionType)
+		report.Unfolding = unfoldingSkipped
+		writeReport(writer, http.StatusOK, report)
+		return
+	}
+
+	republished := append([]string{}, currentRelations.Contains...)
+	if currentRelations.ContainedIn != "" {
+		republished = append(republished, currentRelations.ContainedIn)
+	}
+
+	if len(republished) == 0 {
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip republishing. Collection has no members.", tid, uuid, collectionType)
+		report.Unfolding = unfoldingNoop
+		writeReport(writer, http.StatusOK, report)
+		return
+	}
+
+	job := unfoldingJob{
+		tid:            tid,
+		uuid:           uuid,
+		collectionType: collectionType,
+		lastModified:   time.Now().UTC().Format(res.DateTimeFormat),
+		diffUuids:      republished,
+		options:        messageOptions(unfoldingPolicy, changeTypes(members)),
+		release:        lock.share(),
+	}
+
+	result, queued, err := u.unfoldOrQueue(ctx, job)
+	if err != nil {
+		writeError(writer, upstreamErrorStatus(ctx, err), err)
+		return
+	}
+
+	if queued {
+		report.Unfolding = unfoldingQueued
+		writeReport(writer, http.StatusAccepted, report)
+		return
+	}
+
+	report.Unfolding = unfoldingDone
+	report.addResult(result)
+	if result.sendErr != nil {
+		writeReport(writer, u.sendFailureStatus, report)
+		return
+	}
+	writeReport(writer, http.StatusOK, report)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
+	"github.com/Financial-Times/content-collection-unfolder/relations"
+	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/transactionid-utils-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRepublish_AllOk(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	currentRelations := relations.CCRelations{
+		ContainedIn: leadArticleUuid,
+		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid},
+	}
+	contentArr := []map[string]interface{}{
+		{"uuid": firstExistingItemUuid},
+		{"uuid": secondExistingItemUuid},
+		{"uuid": leadArticleUuid},
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRepublishRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&currentRelations, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(expectStringSlice(t, []string{firstExistingItemUuid, secondExistingItemUuid, leadArticleUuid})),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(func(actual string) bool {
+			_, err := time.Parse(resolver.DateTimeFormat, actual)
+			assert.NoError(t, err)
+			return true
+		}),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: map[string]string{
+			firstExistingItemUuid:  prod.ChangeUnchanged,
+			secondExistingItemUuid: prod.ChangeUnchanged,
+		}}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	report := readReport(t, resp)
+	assert.Equal(t, unfoldingDone, report.Unfolding)
+	assert.Equal(t, 0, report.WriterStatus)
+	assert.ElementsMatch(t, []string{firstExistingItemUuid, secondExistingItemUuid, leadArticleUuid}, report.Sent)
+
+	mock.AssertExpectationsForObjects(t, mrr, mcr, mcp)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRepublish_RelationsResolverError(t *testing.T) {
+	_, mrr, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRepublishRequest(t, server.URL, whitelistedCollection, collectionUuid, tid)
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&relations.CCRelations{}, errors.New("relations resolver error"))
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusInternalServerError, tid, resp)
+
+	mrr.AssertExpectations(t)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRepublish_NotWhitelistedCollectionType(t *testing.T) {
+	_, mrr, _, _, mcr, mcp, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRepublishRequest(t, server.URL, ignoredCollection, collectionUuid, tid)
+
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&relations.CCRelations{Contains: []string{firstExistingItemUuid}}, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+	assert.Equal(t, unfoldingSkipped, readReport(t, resp).Unfolding)
+
+	mrr.AssertExpectations(t)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
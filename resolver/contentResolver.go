@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,6 +14,8 @@ import (
 type ContentResolver interface {
 	ResolveContents(diffUuids []string, tid string) ([]map[string]interface{}, error)
 	ResolveContentsNew(diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error)
+	// ResolveContentsContext works like ResolveContentsNew, but gives up once ctx is done.
+	ResolveContentsContext(ctx context.Context, diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error)
 	GetRequestTimeout() time.Duration
 }
 
@@ -80,10 +83,14 @@ func (cr *defaultContentResolver) GetRequestTimeout() time.Duration {
 }
 
 func (cr *defaultContentResolver) ResolveContentsNew(diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error) {
-	return cr.callContentResolverAppNew(diffUuids, tid, requestTimeout)
+	return cr.ResolveContentsContext(context.Background(), diffUuids, tid, requestTimeout)
 }
 
-func (cr *defaultContentResolver) callContentResolverAppNew(diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error) {
+func (cr *defaultContentResolver) ResolveContentsContext(ctx context.Context, diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error) {
+	return cr.callContentResolverAppNew(ctx, diffUuids, tid, requestTimeout)
+}
+
+func (cr *defaultContentResolver) callContentResolverAppNew(ctx context.Context, diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error) {
 	jsonResponses := make(chan []map[string]interface{}, 1)
 
 	req, err := cr.createRequest(tid)
@@ -93,13 +100,17 @@ func (cr *defaultContentResolver) callContentResolverAppNew(diffUuids []string,
 	httpQuery := req.URL.Query()
 	for _, diffUuid := range diffUuids {
 		httpQuery.Add("uuid", diffUuid)
-		time.Sleep(requestTimeout)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Gave up calling [%v], transaction_id=[%v]: %v", cr.contentResolverAppURI, tid, ctx.Err())
+		case <-time.After(requestTimeout):
+		}
 	}
 
 	req.URL.RawQuery = httpQuery.Encode()
-	resp, err := cr.httpClient.Do(req)
+	resp, err := cr.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("Error doing request to uri=[%v], transaction_id=[%v].", cr.contentResolverAppURI, tid)
+		return nil, fmt.Errorf("Error doing request to uri=[%v], transaction_id=[%v]: %w", cr.contentResolverAppURI, tid, err)
 	}
 
 	bodyAsBytes, err := ioutil.ReadAll(resp.Body)
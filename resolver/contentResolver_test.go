@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -111,3 +112,17 @@ func Test_callContentResolverApp_NotWorking(t *testing.T) {
 		assert.FailNow(t, "Should have thrown error for failing to reach service.", err.Error())
 	}
 }
+
+func Test_callContentResolverApp_Cancelled(t *testing.T) {
+	mockDSAPI(t, statusWorking, "document-store-api-1-content-output.json")
+	defer dsAPIMock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := contentResolver.ResolveContentsContext(ctx, []string{"ab43b1a6-1f47-11e7-b7d3-163f5a7f229c"}, tid, requestTimeout)
+
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < requestTimeout, "the resolver should stop waiting once the context is done")
+}
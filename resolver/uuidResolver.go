@@ -2,37 +2,68 @@ package resolver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Financial-Times/uuid-utils-go"
 )
 
-const dateTimeFormat = "2006-01-02T15:04:05.000Z0700"
+// DateTimeFormat is the layout of the lastModified field of content collections.
+const DateTimeFormat = "2006-01-02T15:04:05.000Z0700"
+
+// The errors returned by Resolve for a collection that is well formed but cannot be accepted.
+// They are wrapped with the details of the failure, use errors.Is to tell them apart.
+var (
+	ErrUUIDMismatch            = errors.New("collection uuid does not match the uuid in the path")
+	ErrDuplicateItem           = errors.New("collection has duplicate items")
+	ErrMissingPublishReference = errors.New("collection has no publishReference")
+	ErrTooManyItems            = errors.New("collection has too many items")
+)
 
 type UuidsAndDateResolver interface {
-	Resolve(reqData []byte) (UuidsAndDate, error)
+	// Resolve parses the collection that is written to collectionUUID and checks that it can be accepted.
+	Resolve(collectionUUID string, reqData []byte) (UuidsAndDate, error)
 }
 
 type UuidsAndDate struct {
-	UuidArr      []string
-	LastModified string
+	UuidArr          []string
+	LastModified     string
+	PublishReference string
 }
 
 type fromRequestResolver struct {
+	maxItems int
 }
 
 func NewUuidResolver() UuidsAndDateResolver {
-	return &fromRequestResolver{}
+	return NewUuidResolverWithMaxItems(0)
+}
+
+// NewUuidResolverWithMaxItems refuses collections with more than maxItems items. Zero means no limit.
+func NewUuidResolverWithMaxItems(maxItems int) UuidsAndDateResolver {
+	return &fromRequestResolver{maxItems: maxItems}
 }
 
-func (r *fromRequestResolver) Resolve(reqData []byte) (UuidsAndDate, error) {
+func (r *fromRequestResolver) Resolve(collectionUUID string, reqData []byte) (UuidsAndDate, error) {
 	cc := contentCollection{}
 	err := json.Unmarshal(reqData, &cc)
 	if err != nil {
 		return UuidsAndDate{}, fmt.Errorf("Unmarshalling error: %v", err)
 	}
 
+	if cc.UUID != collectionUUID {
+		return UuidsAndDate{}, fmt.Errorf("%w: body has [%v], path has [%v]", ErrUUIDMismatch, cc.UUID, collectionUUID)
+	}
+
+	if cc.PublishReference == "" {
+		return UuidsAndDate{}, ErrMissingPublishReference
+	}
+
+	if r.maxItems > 0 && len(cc.Items) > r.maxItems {
+		return UuidsAndDate{}, fmt.Errorf("%w: [%d] items, at most [%d] allowed", ErrTooManyItems, len(cc.Items), r.maxItems)
+	}
+
 	uuidArr, err := resolveUuids(cc)
 	if err != nil {
 		return UuidsAndDate{}, err
@@ -43,17 +74,23 @@ func (r *fromRequestResolver) Resolve(reqData []byte) (UuidsAndDate, error) {
 		return UuidsAndDate{}, err
 	}
 
-	return UuidsAndDate{uuidArr, lastModified}, nil
+	return UuidsAndDate{UuidArr: uuidArr, LastModified: lastModified, PublishReference: cc.PublishReference}, nil
 }
 
 func resolveUuids(cc contentCollection) ([]string, error) {
 	var uuidArr []string
+	seen := map[string]bool{}
 	for _, item := range cc.Items {
 		err := uuidutils.ValidateUUID(item.Uuid)
 		if err != nil {
 			return nil, fmt.Errorf("UUID validation error: %v", err)
 		}
 
+		if seen[item.Uuid] {
+			return nil, fmt.Errorf("%w: [%v] appears more than once", ErrDuplicateItem, item.Uuid)
+		}
+		seen[item.Uuid] = true
+
 		uuidArr = append(uuidArr, item.Uuid)
 	}
 
@@ -61,7 +98,7 @@ func resolveUuids(cc contentCollection) ([]string, error) {
 }
 
 func resolveLastModified(cc contentCollection) (string, error) {
-	if _, err := time.Parse(dateTimeFormat, cc.LastModified); err != nil {
+	if _, err := time.Parse(DateTimeFormat, cc.LastModified); err != nil {
 		return "", fmt.Errorf("Invalid lastModified value. Error was: %v", err)
 	}
 
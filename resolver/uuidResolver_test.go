@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"os"
 	"testing"
@@ -9,14 +10,17 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+const collectionUUID = "45163790-eec9-11e6-abbc-ee7d9c5b3b90"
+
 func TestValidInput(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection.json")
 
 	r := NewUuidResolver()
-	uuidsAndDate, err := r.Resolve(ccBytes)
+	uuidsAndDate, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.NoError(t, err)
 	assert.Equal(t, "2017-01-31T15:33:21.687Z", uuidsAndDate.LastModified)
+	assert.Equal(t, "tdi23377744", uuidsAndDate.PublishReference)
 	assert.Equal(t, 3, len(uuidsAndDate.UuidArr))
 	assert.Contains(t, uuidsAndDate.UuidArr, "aaaac4c6-dcc6-11e6-86ac-f253db7791c6")
 	assert.Contains(t, uuidsAndDate.UuidArr, "bbbbc4c6-dcc6-11e6-86ac-f253db7791c6")
@@ -27,7 +31,7 @@ func TestEmptyItems(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection-empty-items.json")
 
 	r := NewUuidResolver()
-	uuidsAndDate, err := r.Resolve(ccBytes)
+	uuidsAndDate, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(uuidsAndDate.UuidArr))
@@ -37,7 +41,7 @@ func TestNoItems(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection-no-items.json")
 
 	r := NewUuidResolver()
-	uuidsAndDate, err := r.Resolve(ccBytes)
+	uuidsAndDate, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(uuidsAndDate.UuidArr))
@@ -47,7 +51,7 @@ func TestNoLastModified(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection-no-lastModified.json")
 
 	r := NewUuidResolver()
-	_, err := r.Resolve(ccBytes)
+	_, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.Error(t, err)
 }
@@ -56,7 +60,7 @@ func TestNoUuid(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection-no-uuid.json")
 
 	r := NewUuidResolver()
-	_, err := r.Resolve(ccBytes)
+	_, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.Error(t, err)
 }
@@ -65,7 +69,7 @@ func TestInvalidLastModified(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection-invalid-lastModified.json")
 
 	r := NewUuidResolver()
-	_, err := r.Resolve(ccBytes)
+	_, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.Error(t, err)
 }
@@ -74,11 +78,48 @@ func TestInvalidUuid(t *testing.T) {
 	ccBytes := readTestFile(t, "content-collection-invalid-uuid.json")
 
 	r := NewUuidResolver()
-	_, err := r.Resolve(ccBytes)
+	_, err := r.Resolve(collectionUUID, ccBytes)
 
 	assert.Error(t, err)
 }
 
+func TestUuidMismatch(t *testing.T) {
+	ccBytes := readTestFile(t, "content-collection.json")
+
+	r := NewUuidResolver()
+	_, err := r.Resolve("d4986a58-de3b-11e6-86ac-f253db7791c6", ccBytes)
+
+	assert.True(t, errors.Is(err, ErrUUIDMismatch), "unexpected error %v", err)
+}
+
+func TestDuplicateItems(t *testing.T) {
+	ccBytes := []byte(`{"uuid": "` + collectionUUID + `", "items": [{"uuid": "aaaac4c6-dcc6-11e6-86ac-f253db7791c6"}, {"uuid": "aaaac4c6-dcc6-11e6-86ac-f253db7791c6"}], "publishReference": "tid_test", "lastModified": "2017-01-31T15:33:21.687Z"}`)
+
+	r := NewUuidResolver()
+	_, err := r.Resolve(collectionUUID, ccBytes)
+
+	assert.True(t, errors.Is(err, ErrDuplicateItem), "unexpected error %v", err)
+}
+
+func TestNoPublishReference(t *testing.T) {
+	ccBytes := []byte(`{"uuid": "` + collectionUUID + `", "items": [], "lastModified": "2017-01-31T15:33:21.687Z"}`)
+
+	r := NewUuidResolver()
+	_, err := r.Resolve(collectionUUID, ccBytes)
+
+	assert.True(t, errors.Is(err, ErrMissingPublishReference), "unexpected error %v", err)
+}
+
+func TestTooManyItems(t *testing.T) {
+	ccBytes := readTestFile(t, "content-collection.json")
+
+	_, err := NewUuidResolverWithMaxItems(2).Resolve(collectionUUID, ccBytes)
+	assert.True(t, errors.Is(err, ErrTooManyItems), "unexpected error %v", err)
+
+	_, err = NewUuidResolverWithMaxItems(3).Resolve(collectionUUID, ccBytes)
+	assert.NoError(t, err)
+}
+
 func readTestFile(t *testing.T, fileName string) []byte {
 	file, err := os.Open("../test-resources/" + fileName)
 	assert.NoError(t, err)
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	health "github.com/Financial-Times/go-fthealth/v1_1"
 	logger "github.com/Financial-Times/go-logger"
@@ -34,15 +40,41 @@ func (r routing) routAdminEndpoints() {
 	r.router.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler).Methods(http.MethodGet)
 	r.router.HandleFunc(status.BuildInfoPathDW, status.BuildInfoHandler).Methods(http.MethodGet)
 	r.router.HandleFunc(status.PingPath, status.PingHandler).Methods(http.MethodGet)
+	r.router.Handle(metricsPath, expvar.Handler()).Methods(http.MethodGet)
 }
 
 func (r routing) routProdEndpoints() {
 	r.router.HandleFunc(unfolderPath, r.unfolder.handle).Methods(http.MethodPut)
+	r.router.HandleFunc(unfolderPath, r.unfolder.handleDelete).Methods(http.MethodDelete)
+	r.router.HandleFunc(previewPath, r.unfolder.handlePreview).Methods(http.MethodPost)
+	r.router.HandleFunc(republishPath, r.unfolder.handleRepublish).Methods(http.MethodPost)
+	r.router.HandleFunc(batchPath, r.unfolder.handleBatch).Methods(http.MethodPost)
 }
 
+const (
+	shutdownTimeout = 10 * time.Second
+	metricsPath     = "/__metrics"
+)
+
+// listenAndServe blocks until the process receives SIGINT or SIGTERM, then stops the server gracefully.
 func (r routing) listenAndServe(port string) {
-	err := http.ListenAndServe(":"+port, r.router)
-	if err != nil {
-		logger.Fatalf("Error during ListenAndServe: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: r.router}
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Error during ListenAndServe: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	logger.Infof("[Shutdown] content-collection-unfolder is shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Errorf("Error during server shutdown: %v", err)
 	}
 }
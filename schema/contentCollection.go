@@ -0,0 +1,35 @@
+package schema
+
+// ContentCollection is the schema every content collection is validated against, unless its type has one of its own.
+const ContentCollection = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Content collection",
+  "type": "object",
+  "required": ["uuid", "lastModified"],
+  "properties": {
+    "uuid": {
+      "type": "string",
+      "pattern": "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"
+    },
+    "items": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["uuid"],
+        "properties": {
+          "uuid": {
+            "type": "string",
+            "pattern": "^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$"
+          }
+        }
+      }
+    },
+    "publishReference": {
+      "type": "string"
+    },
+    "lastModified": {
+      "type": "string",
+      "minLength": 1
+    }
+  }
+}`
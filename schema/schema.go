@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Violation is a part of a document that does not match its schema. Pointer is the JSON pointer of that part.
+type Violation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// Schema is a JSON Schema of draft-04, draft-06 or draft-07, as told by its $schema, compiled by gojsonschema.
+// References are resolved against the schema itself, like "#/definitions/uuid".
+type Schema struct {
+	compiled *gojsonschema.Schema
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// contextSeparator splits the path gojsonschema reports a violation at, as property names may contain dots.
+const contextSeparator = "\x00"
+
+func Parse(data []byte) (*Schema, error) {
+	var keywords map[string]interface{}
+	if err := decode(data, &keywords); err != nil {
+		return nil, fmt.Errorf("schema is not a JSON object: %v", err)
+	}
+
+	compiled, err := gojsonschema.NewSchemaLoader().Compile(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &Schema{compiled: compiled}, nil
+}
+
+// Validate returns every violation of the schema found in the document, or none if the document matches it.
+// The violations are sorted by pointer.
+func (s *Schema) Validate(document []byte) []Violation {
+	var value interface{}
+	if err := decode(document, &value); err != nil {
+		return []Violation{{Pointer: "", Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	result, err := s.compiled.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return []Violation{{Pointer: "", Message: fmt.Sprintf("unable to validate: %v", err)}}
+	}
+
+	violations := []Violation{}
+	for _, resultError := range result.Errors() {
+		violations = append(violations, Violation{Pointer: pointerOf(resultError), Message: resultError.Description()})
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Pointer < violations[j].Pointer
+	})
+	return violations
+}
+
+// pointerOf turns the path gojsonschema reports a violation at, like (root).items.0, into a JSON pointer.
+// Properties that are not allowed are pointed at themselves rather than at the object holding them.
+func pointerOf(resultError gojsonschema.ResultError) string {
+	segments := strings.Split(resultError.Context().String(contextSeparator), contextSeparator)[1:]
+	if resultError.Type() == "additional_property_not_allowed" {
+		if property, ok := resultError.Details()["property"].(string); ok {
+			segments = append(segments, property)
+		}
+	}
+
+	pointer := ""
+	for _, segment := range segments {
+		pointer += "/" + pointerEscaper.Replace(segment)
+	}
+	return pointer
+}
+
+// decode keeps numbers as json.Number, so that integers can be told from other numbers.
+// Anything after the document is refused, like a second document.
+func decode(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the document")
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["name", "tags"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string", "minLength": 2, "maxLength": 5},
+    "kind": {"enum": ["a", "b"]},
+    "count": {"type": "integer", "minimum": 1, "maximum": 3},
+    "tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "pattern": "^[a-z]+$"}},
+    "meta": {"type": "object", "additionalProperties": {"type": "boolean"}}
+  }
+}`
+
+func TestValidDocument(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	violations := s.Validate([]byte(`{"name": "abc", "kind": "a", "count": 2, "tags": ["x"], "meta": {"a/b": true}}`))
+	assert.Empty(t, violations)
+}
+
+func TestViolationsHaveJSONPointers(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	violations := s.Validate([]byte(`{"name": "a", "kind": "c", "count": 1.5, "tags": ["x", "Y", "z"], "meta": {"a/b": 1}, "extra": null}`))
+
+	pointers := []string{}
+	for _, violation := range violations {
+		assert.NotEmpty(t, violation.Message)
+		pointers = append(pointers, violation.Pointer)
+	}
+	assert.Equal(t, []string{"/count", "/extra", "/kind", "/meta/a~1b", "/name", "/tags", "/tags/1"}, pointers)
+}
+
+func TestMissingRequiredProperties(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Violation{
+		{Pointer: "", Message: "name is required"},
+		{Pointer: "", Message: "tags is required"},
+	}, s.Validate([]byte(`{}`)))
+}
+
+func TestDraft07Keywords(t *testing.T) {
+	s, err := Parse([]byte(`{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "definitions": {"uuid": {"type": "string", "format": "uuid"}},
+  "type": "object",
+  "properties": {
+    "uuid": {"$ref": "#/definitions/uuid"},
+    "version": {"const": 1},
+    "layout": {"oneOf": [{"type": "string"}, {"type": "integer"}]}
+  }
+}`))
+	assert.NoError(t, err)
+
+	assert.Empty(t, s.Validate([]byte(`{"uuid": "45163790-eec9-11e6-abbc-ee7d9c5b3b90", "version": 1, "layout": 2}`)))
+
+	pointers := []string{}
+	for _, violation := range s.Validate([]byte(`{"uuid": "not-a-uuid", "version": 2, "layout": true}`)) {
+		pointers = append(pointers, violation.Pointer)
+	}
+	assert.Contains(t, pointers, "/uuid")
+	assert.Contains(t, pointers, "/version")
+	assert.Contains(t, pointers, "/layout")
+}
+
+func TestInvalidJSON(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	violations := s.Validate([]byte(`{`))
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "", violations[0].Pointer)
+}
+
+func TestTrailingData(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	violations := s.Validate([]byte(`{"name": "abc", "tags": []} {"name": "abc"}`))
+	assert.Len(t, violations, 1)
+	assert.Contains(t, violations[0].Message, "after the document")
+
+	_, err = Parse([]byte(`{"type": "object"} x`))
+	assert.Error(t, err)
+}
+
+func TestInvalidSchema(t *testing.T) {
+	_, err := Parse([]byte(`{"type": "object", "properties": {"a": {"type": "text"}}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const schemaExtension = ".json"
+
+var contentCollection = mustParse(ContentCollection)
+
+// Schemas holds the schema of every collection type. Types without a schema of their own use the bundled one.
+type Schemas struct {
+	byType map[string]*Schema
+}
+
+func NewSchemas(byType map[string]*Schema) *Schemas {
+	s := Schemas{byType: map[string]*Schema{}}
+	for collectionType, schema := range byType {
+		s.byType[collectionType] = schema
+	}
+	return &s
+}
+
+// Bundled validates every collection type against the bundled content collection schema.
+func Bundled() *Schemas {
+	return NewSchemas(nil)
+}
+
+// LoadDir reads the schemas of collection types from dir, one file per type named after it, like content-package.json.
+func LoadDir(dir string) (*Schemas, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema directory [%v]: %v", dir, err)
+	}
+
+	byType := map[string]*Schema{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), schemaExtension) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schema file [%v]: %v", file.Name(), err)
+		}
+
+		schema, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse schema file [%v]: %v", file.Name(), err)
+		}
+		byType[strings.TrimSuffix(file.Name(), schemaExtension)] = schema
+	}
+
+	return NewSchemas(byType), nil
+}
+
+func (s *Schemas) For(collectionType string) *Schema {
+	if schema, ok := s.byType[collectionType]; ok {
+		return schema
+	}
+	return contentCollection
+}
+
+func mustParse(schema string) *Schema {
+	parsed, err := Parse([]byte(schema))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundledSchema(t *testing.T) {
+	s := Bundled().For("content-package")
+
+	valid, err := ioutil.ReadFile("../test-resources/content-collection.json")
+	assert.NoError(t, err)
+	assert.Empty(t, s.Validate(valid))
+
+	assert.Equal(t, []Violation{
+		{Pointer: "", Message: "lastModified is required"},
+		{Pointer: "/items/0", Message: "uuid is required"},
+		{Pointer: "/items/1/uuid", Message: "Invalid type. Expected: string, given: integer"},
+	}, s.Validate([]byte(`{"uuid": "45163790-eec9-11e6-abbc-ee7d9c5b3b90", "items": [{}, {"uuid": 1}]}`)))
+}
+
+func TestLoadDirOverridesType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemas")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "story-package.json"), []byte(`{"type": "object", "required": ["title"]}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a schema"), 0644))
+
+	schemas, err := LoadDir(dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Violation{{Pointer: "", Message: "title is required"}}, schemas.For("story-package").Validate([]byte(`{}`)))
+	assert.Len(t, schemas.For("content-package").Validate([]byte(`{}`)), 2)
+}
+
+func TestLoadDirInvalidSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemas")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "story-package.json"), []byte(`{"type": "text"}`), 0644))
+
+	_, err = LoadDir(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package ttlmap
+
+import (
+	"container/list"
+	"time"
+)
+
+// Map keeps up to capacity values, each until it expires. When full, the value that expires first is dropped.
+// A Map is not safe for concurrent use: its users guard it together with the state they keep next to it.
+type Map struct {
+	capacity int
+	elements map[interface{}]*list.Element
+	// order keeps the entries ordered by expiry, so the expired ones and the first to drop are always at the front
+	order *list.List
+}
+
+// Entry is a value kept in a Map.
+type Entry struct {
+	Key     interface{}
+	Value   interface{}
+	Expires time.Time
+}
+
+func New(capacity int) *Map {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &Map{
+		capacity: capacity,
+		elements: map[interface{}]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Get returns the value of key, unless it expired by now.
+func (m *Map) Get(key interface{}, now time.Time) (interface{}, bool) {
+	m.RemoveExpired(now)
+	element, ok := m.elements[key]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*Entry).Value, true
+}
+
+// Put replaces the value of key. Values are mostly put with a fixed ttl, so the new one usually goes to the back.
+func (m *Map) Put(key interface{}, value interface{}, expires time.Time) {
+	m.Remove(key)
+
+	entry := &Entry{Key: key, Value: value, Expires: expires}
+	mark := m.order.Back()
+	for mark != nil && mark.Value.(*Entry).Expires.After(expires) {
+		mark = mark.Prev()
+	}
+	if mark == nil {
+		m.elements[key] = m.order.PushFront(entry)
+	} else {
+		m.elements[key] = m.order.InsertAfter(entry, mark)
+	}
+
+	for m.order.Len() > m.capacity {
+		m.remove(m.order.Front())
+	}
+}
+
+func (m *Map) Remove(key interface{}) {
+	if element, ok := m.elements[key]; ok {
+		m.remove(element)
+	}
+}
+
+// RemoveIf removes the values whose key matches.
+func (m *Map) RemoveIf(matches func(key interface{}) bool) {
+	for key, element := range m.elements {
+		if matches(key) {
+			m.remove(element)
+		}
+	}
+}
+
+func (m *Map) RemoveExpired(now time.Time) {
+	for element := m.order.Front(); element != nil && !element.Value.(*Entry).Expires.After(now); element = m.order.Front() {
+		m.remove(element)
+	}
+}
+
+// Entries returns the values not expired by now, the first to expire first.
+func (m *Map) Entries(now time.Time) []Entry {
+	m.RemoveExpired(now)
+	entries := make([]Entry, 0, m.order.Len())
+	for element := m.order.Front(); element != nil; element = element.Next() {
+		entries = append(entries, *element.Value.(*Entry))
+	}
+	return entries
+}
+
+// Len returns the number of values kept, counting the expired ones not removed yet.
+func (m *Map) Len() int {
+	return m.order.Len()
+}
+
+func (m *Map) remove(element *list.Element) {
+	m.order.Remove(element)
+	delete(m.elements, element.Value.(*Entry).Key)
+}
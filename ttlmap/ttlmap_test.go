@@ -0,0 +1,69 @@
+package ttlmap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAfterPut(t *testing.T) {
+	now := time.Now()
+	m := New(10)
+
+	_, found := m.Get("first", now)
+	assert.False(t, found)
+
+	m.Put("first", 1, now.Add(time.Minute))
+	m.Put("first", 2, now.Add(time.Minute))
+
+	value, found := m.Get("first", now)
+	assert.True(t, found)
+	assert.Equal(t, 2, value)
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestValuesExpire(t *testing.T) {
+	now := time.Now()
+	m := New(10)
+
+	m.Put("first", 1, now.Add(time.Minute))
+	m.Put("second", 2, now.Add(2*time.Minute))
+
+	_, found := m.Get("first", now.Add(time.Minute))
+	assert.False(t, found)
+	_, found = m.Get("second", now.Add(time.Minute))
+	assert.True(t, found)
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestFirstToExpireIsDroppedWhenFull(t *testing.T) {
+	now := time.Now()
+	m := New(2)
+
+	m.Put("first", 1, now.Add(2*time.Minute))
+	m.Put("second", 2, now.Add(time.Minute))
+	m.Put("third", 3, now.Add(3*time.Minute))
+
+	_, found := m.Get("second", now)
+	assert.False(t, found)
+	assert.Equal(t, []Entry{
+		{Key: "first", Value: 1, Expires: now.Add(2 * time.Minute)},
+		{Key: "third", Value: 3, Expires: now.Add(3 * time.Minute)},
+	}, m.Entries(now))
+}
+
+func TestRemoveIf(t *testing.T) {
+	now := time.Now()
+	m := New(10)
+
+	m.Put("first", 1, now.Add(time.Minute))
+	m.Put("second", 2, now.Add(time.Minute))
+	m.RemoveIf(func(key interface{}) bool { return key == "first" })
+	m.Remove("missing")
+
+	_, found := m.Get("first", now)
+	assert.False(t, found)
+	_, found = m.Get("second", now)
+	assert.True(t, found)
+}
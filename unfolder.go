@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
 	"github.com/Financial-Times/content-collection-unfolder/differ"
 	fw "github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/idempotency"
+	"github.com/Financial-Times/content-collection-unfolder/outbox"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
 	prod "github.com/Financial-Times/content-collection-unfolder/producer"
 	"github.com/Financial-Times/content-collection-unfolder/relations"
 	res "github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/content-collection-unfolder/schema"
 	logger "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/transactionid-utils-go"
 	"github.com/Financial-Times/uuid-utils-go"
@@ -20,16 +30,39 @@ import (
 
 const (
 	unfolderPath = "/content-collection/{collectionType}/{uuid}"
+	replayHeader = "X-Idempotent-Replay"
+	forceParam   = "force"
+	forceHeader  = "X-Force-Unfold"
 )
 
+var sendFailurePolicies = map[string]int{
+	"report":       http.StatusOK,
+	"multi-status": http.StatusMultiStatus,
+	"fail":         http.StatusServiceUnavailable,
+}
+
 type unfolder struct {
-	uuidsAndDateRes   res.UuidsAndDateResolver
-	relationsResolver relations.RelationsResolver
-	collectionsDiffer differ.CollectionsDiffer
-	forwarder         fw.Forwarder
-	contentRes        res.ContentResolver
-	producer          prod.ContentProducer
-	whitelist         map[string]struct{}
+	uuidsAndDateRes     res.UuidsAndDateResolver
+	relationsResolver   relations.RelationsResolver
+	collectionsDiffer   differ.CollectionsDiffer
+	forwarder           fw.Forwarder
+	contentRes          res.ContentResolver
+	producer            prod.ContentProducer
+	policies            *policy.Policies
+	pool                *unfoldingPool
+	sendFailureStatus   int
+	publishes           idempotency.Store
+	freshness           *freshnessTracker
+	locks               *collectionLocks
+	outbox              outbox.Outbox
+	outboxRetryInterval time.Duration
+	outboxMaxAttempts   int
+	dispatcher          *outboxDispatcher
+	batchConcurrency    int
+	batchMaxLines       int
+	batchMaxBytes       int64
+	requestDeadline     time.Duration
+	schemas             *schema.Schemas
 }
 
 func newUnfolder(uuidsAndDateRes res.UuidsAndDateResolver,
@@ -38,7 +71,7 @@ func newUnfolder(uuidsAndDateRes res.UuidsAndDateResolver,
 	forwarder fw.Forwarder,
 	contentRes res.ContentResolver,
 	producer prod.ContentProducer,
-	whitelist []string) *unfolder {
+	policies *policy.Policies) *unfolder {
 
 	u := unfolder{
 		uuidsAndDateRes:   uuidsAndDateRes,
@@ -47,16 +80,126 @@ func newUnfolder(uuidsAndDateRes res.UuidsAndDateResolver,
 		forwarder:         forwarder,
 		contentRes:        contentRes,
 		producer:          producer,
-		whitelist:         map[string]struct{}{},
+		policies:          policies,
+		sendFailureStatus: http.StatusOK,
+		freshness:         newFreshnessTracker(defaultFreshnessCapacity, defaultFreshnessTTL),
+		locks:             newCollectionLocks(defaultCollectionLockTimeout),
+		batchConcurrency:  defaultBatchConcurrency,
+		batchMaxLines:     defaultBatchMaxLines,
+		batchMaxBytes:     defaultBatchMaxBytes,
+		schemas:           schema.Bundled(),
 	}
 
-	for _, val := range whitelist {
-		u.whitelist[val] = struct{}{}
+	return &u
+}
+
+// enableAsyncUnfolding makes the unfolder answer with 202 once the writer succeeded and do the unfolding in the background.
+func (u *unfolder) enableAsyncUnfolding(workers int, queueSize int) {
+	u.pool = newUnfoldingPool(workers, queueSize, func(job unfoldingJob) {
+		// the request is over, so the job gets a budget of its own
+		ctx, cancel := u.withDeadline(context.Background())
+		defer cancel()
+		defer job.done()
+		// errors are already logged by unfold, there is no client left to report them to
+		_, _ = u.unfold(ctx, job)
+	})
+}
+
+// setSendFailurePolicy decides the status returned when some of the kafka messages could not be sent.
+func (u *unfolder) setSendFailurePolicy(policy string) error {
+	status, ok := sendFailurePolicies[policy]
+	if !ok {
+		return fmt.Errorf("unknown send failure policy [%v]", policy)
 	}
+	u.sendFailureStatus = status
+	return nil
+}
 
-	return &u
+// checkSendFailurePolicy refuses the fail policy without the outbox. The writer already holds the new members when the
+// messages fail, so the publisher retrying finds nothing left to notify: only the outbox sends the failed messages again.
+func (u *unfolder) checkSendFailurePolicy() error {
+	if u.sendFailureStatus == http.StatusServiceUnavailable && u.outbox == nil {
+		return errors.New("the fail send failure policy needs the outbox to retry the failed messages")
+	}
+	return nil
+}
+
+// enableIdempotency makes the unfolder answer a repeated publish with the outcome of the first one,
+// without forwarding or unfolding the collection again.
+func (u *unfolder) enableIdempotency(publishes idempotency.Store) {
+	u.publishes = publishes
+}
+
+// setCollectionLockTimeout bounds how long an update waits for the previous update of the same collection.
+func (u *unfolder) setCollectionLockTimeout(timeout time.Duration) {
+	u.locks.timeout = timeout
 }
 
+// setFreshnessLimits bounds how many collections the stale updates are tracked for, and for how long.
+func (u *unfolder) setFreshnessLimits(capacity int, ttl time.Duration) {
+	u.freshness = newFreshnessTracker(capacity, ttl)
+}
+
+// setRequestDeadline bounds the time a request may spend calling the writer, relations-api, the document-store-api and kafka.
+// Zero means no bound.
+func (u *unfolder) setRequestDeadline(deadline time.Duration) {
+	u.requestDeadline = deadline
+}
+
+// setSchemas replaces the schemas the incoming collections are validated against.
+func (u *unfolder) setSchemas(schemas *schema.Schemas) {
+	u.schemas = schemas
+}
+
+// setBatchConcurrency bounds how many collections of a batch are processed at the same time.
+func (u *unfolder) setBatchConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	u.batchConcurrency = concurrency
+}
+
+// setBatchLimits bounds the number of collections and the size of a batch. Larger batches are answered with 413.
+func (u *unfolder) setBatchLimits(maxLines int, maxBytes int64) {
+	u.batchMaxLines = maxLines
+	u.batchMaxBytes = maxBytes
+}
+
+// enableOutbox keeps the notifications in the outbox until they are delivered, and retries the undelivered ones
+// in the background, waiting retryInterval after the first failure and twice as long after every other.
+// After maxAttempts attempts the notifications are dead-lettered. Zero means no limit.
+func (u *unfolder) enableOutbox(o outbox.Outbox, retryInterval time.Duration, maxAttempts int) {
+	u.outbox = o
+	u.outboxRetryInterval = retryInterval
+	u.outboxMaxAttempts = maxAttempts
+	u.dispatcher = newOutboxDispatcher(u, outboxPollInterval)
+	u.dispatcher.start()
+}
+
+// drain waits for the background unfolding to finish, then stops retrying the notifications in the outbox
+// and waits for the replays to the shadow writer. Each wait takes at most timeout.
+func (u *unfolder) drain(timeout time.Duration) {
+	if u.pool != nil {
+		logger.Infof("Draining async unfolding queue")
+		if u.pool.drain(timeout) {
+			logger.Infof("Async unfolding queue drained")
+		}
+	}
+
+	if u.dispatcher != nil {
+		u.dispatcher.stop()
+	}
+
+	if drainer, ok := u.forwarder.(fw.Drainer); ok {
+		logger.Infof("Waiting for the writer calls made in the background")
+		if drainer.Drain(timeout) {
+			logger.Infof("Writer calls made in the background are done")
+		}
+	}
+}
+
+// handle forwards the collection in the request body to the writer and notifies the members it changed.
+// Every upstream call is aborted once the request is cancelled or runs out of its deadline.
 func (u *unfolder) handle(writer http.ResponseWriter, req *http.Request) {
 	tid := transactionidutils.GetTransactionIDFromRequest(req)
 	uuid, collectionType := extractPathVariables(req)
@@ -64,77 +207,435 @@ func (u *unfolder) handle(writer http.ResponseWriter, req *http.Request) {
 	writer.Header().Add(transactionidutils.TransactionIDHeader, tid)
 	writer.Header().Add("Content-Type", "application/json;charset=utf-8")
 
-	if err := uuidutils.ValidateUUID(uuid); err != nil {
-		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Invalid uuid in request path: %v", tid, uuid, collectionType, err)
-		writeError(writer, http.StatusBadRequest, err)
+	body, ok := readBody(writer, req, tid, uuid, collectionType)
+	if !ok {
 		return
 	}
 
-	defer req.Body.Close()
-	body, err := ioutil.ReadAll(req.Body)
+	ctx, cancel := u.withDeadline(req.Context())
+	defer cancel()
+
+	status, report, err := u.putCollection(ctx, tid, uuid, collectionType, body, isForced(req))
 	if err != nil {
-		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unable to extract request body: %v", tid, uuid, collectionType, err)
-		writeError(writer, http.StatusUnprocessableEntity, err)
+		writePutError(writer, status, err)
 		return
 	}
+	if report.replayed {
+		writer.Header().Set(replayHeader, "true")
+	}
+	writeReport(writer, status, report)
+}
 
-	uuidsAndDate, err := u.uuidsAndDateRes.Resolve(body)
+// putCollection forwards the collection to the writer and notifies the members it changed. It returns the status and
+// the report to answer with, or the status and the error of a collection that could not be processed.
+func (u *unfolder) putCollection(ctx context.Context, tid string, uuid string, collectionType string, body []byte, forced bool) (int, *unfoldingReport, error) {
+	if err := validateCollectionUuid(tid, uuid, collectionType); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	collection := u.parseCollection(uuid, body)
+
+	// repeats are answered before waiting for the lock or calling anything upstream
+	publish := idempotency.Key{
+		CollectionUUID:   uuid,
+		PublishReference: collection.uuidsAndDate.PublishReference,
+		LastModified:     collection.uuidsAndDate.LastModified,
+	}
+	if !forced {
+		if status, report, found := u.processedReport(publish); found {
+			logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip forwarding and unfolding. Publish [%v] was already processed.", tid, uuid, collectionType, publish.PublishReference)
+			return status, report, nil
+		}
+	}
+
+	if err := u.validateCollection(tid, uuid, collectionType, collection); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	lock, err := u.lockCollection(tid, uuid, collectionType)
 	if err != nil {
-		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while resolving UUIDs: %v", tid, uuid, collectionType, err)
-		writeError(writer, http.StatusBadRequest, err)
-		return
+		return http.StatusServiceUnavailable, nil, err
+	}
+	defer lock.release()
+
+	// a repeat that waited for the lock may find the publish processed by the request it waited for
+	if !forced {
+		if status, report, found := u.processedReport(publish); found {
+			logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip forwarding and unfolding. Publish [%v] was processed while waiting for the lock.", tid, uuid, collectionType, publish.PublishReference)
+			return status, report, nil
+		}
 	}
 
-	oldCollectionRelations, err := u.relationsResolver.Resolve(uuid, tid)
+	changes, err := u.resolveChanges(ctx, tid, uuid, collectionType, collection)
 	if err != nil {
-		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while fetching old collection relations: %v", tid, uuid, collectionType, err)
-		writeError(writer, http.StatusInternalServerError, err)
-		return
+		return upstreamErrorStatus(ctx, err), nil, err
 	}
 
-	diffUuidsSet := u.collectionsDiffer.SymmetricDifference(uuidsAndDate.UuidArr, oldCollectionRelations.Contains)
+	if err := u.freshness.checkFresh(uuid, changes.uuidsAndDate.LastModified); err != nil {
+		logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip forwarding and unfolding. Stale update: %v", tid, uuid, collectionType, err)
+		return http.StatusConflict, nil, err
+	}
 
-	fwResp, err := u.forwarder.Forward(tid, uuid, collectionType, body)
+	fwResp, err := u.forwarder.ForwardContext(ctx, tid, uuid, collectionType, changes.body)
 	if err != nil {
 		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error during forwarding: %v", tid, uuid, collectionType, err)
-		writeError(writer, http.StatusInternalServerError, err)
-		return
+		return upstreamErrorStatus(ctx, err), nil, err
 	}
 
 	if fwResp.Status != http.StatusOK {
 		logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. Writer returned status [%v]", tid, uuid, collectionType, fwResp.Status)
-		writeResponse(writer, fwResp.Status, fwResp.ResponseBody)
-		return
+		return fwResp.Status, nil, &writerError{response: fwResp}
 	}
+	u.freshness.accept(uuid, changes.uuidsAndDate.LastModified)
 
-	if _, ok := u.whitelist[collectionType]; !ok {
-		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. Collection type [%v] not in unfolding whitelist", tid, uuid, collectionType, collectionType)
-		writeResponse(writer, fwResp.Status, fwResp.ResponseBody)
-		return
+	report := newUnfoldingReport(fwResp.Status, changes)
+	unfoldingPolicy := u.policies.For(collectionType)
+	if forced {
+		unfoldingPolicy = forcedPolicy(unfoldingPolicy)
+		report.Forced = true
 	}
 
-	if oldCollectionRelations.ContainedIn != "" {
-		diffUuidsSet.Add(oldCollectionRelations.ContainedIn)
+	if !unfoldingPolicy.Unfold {
+		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. Collection type [%v] is not unfolded by policy", tid, uuid, collectionType, collectionType)
+		report.Unfolding = unfoldingSkipped
+		return u.processed(publish, http.StatusOK, report)
 	}
 
-	if diffUuidsSet.Len() == 0 {
+	changesByUuid := u.memberChanges(ctx, tid, uuid, collectionType, changes, unfoldingPolicy)
+	containers := u.containerChain(ctx, tid, uuid, collectionType, changes.oldRelations.ContainedIn, changes.diffUuidsSet.Len() > 0, unfoldingPolicy)
+	notifiedUuids := notificationUuids(changes, unfoldingPolicy, containers)
+	if len(notifiedUuids) == 0 {
 		logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip unfolding. No uuids to resolve after diff was done.", tid, uuid, collectionType)
-		writeResponse(writer, http.StatusOK, fwResp.ResponseBody)
-		return
+		report.Unfolding = unfoldingNoop
+		return u.processed(publish, http.StatusOK, report)
+	}
+
+	job := unfoldingJob{
+		tid:            tid,
+		uuid:           uuid,
+		collectionType: collectionType,
+		lastModified:   changes.uuidsAndDate.LastModified,
+		diffUuids:      notifiedUuids,
+		options:        messageOptions(unfoldingPolicy, changesByUuid),
+		release:        lock.share(),
+	}
+
+	result, queued, err := u.unfoldOrQueue(ctx, job)
+	if err != nil {
+		return upstreamErrorStatus(ctx, err), nil, err
+	}
+
+	if queued {
+		report.Unfolding = unfoldingQueued
+		return u.processed(publish, http.StatusAccepted, report)
+	}
+
+	report.Unfolding = unfoldingDone
+	report.addResult(result)
+	if result.sendErr != nil {
+		return u.sendFailureStatus, report, nil
+	}
+	return u.processed(publish, http.StatusOK, report)
+}
+
+// processedReport returns the report of an earlier run of the publish. A publish whose reference could not be parsed
+// has none.
+func (u *unfolder) processedReport(publish idempotency.Key) (int, *unfoldingReport, bool) {
+	if u.publishes == nil || publish.PublishReference == "" {
+		return 0, nil, false
+	}
+
+	outcome, found := u.publishes.Get(publish)
+	if !found {
+		return 0, nil, false
+	}
+
+	report := &unfoldingReport{}
+	if err := json.Unmarshal(outcome.Body, report); err != nil {
+		logger.Warnf("Unable to parse the outcome of publish [%v] of collection [%v], processing it again: %v", publish.PublishReference, publish.CollectionUUID, err)
+		return 0, nil, false
+	}
+	report.replayed = true
+	return outcome.Status, report, true
+}
+
+// processed returns the report of a publish that needs no retry and remembers it for the repeats of the publish.
+// Forced runs are not remembered, so that they never replace the outcome of the original publish.
+func (u *unfolder) processed(publish idempotency.Key, status int, report *unfoldingReport) (int, *unfoldingReport, error) {
+	if u.publishes == nil || publish.PublishReference == "" || report.Forced {
+		return status, report, nil
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		logger.Errorf("Unable to remember the outcome of publish [%v] of collection [%v]: %v", publish.PublishReference, publish.CollectionUUID, err)
+		return status, report, nil
+	}
+	u.publishes.Put(publish, idempotency.Outcome{Status: status, Body: body})
+	return status, report, nil
+}
+
+// unfoldOrQueue hands the job to the async pool if there is one with room for it, otherwise unfolds it right away.
+// It returns true if the job was queued. Either way the job releases its share of the collection lock once it is done.
+func (u *unfolder) unfoldOrQueue(ctx context.Context, job unfoldingJob) (unfoldingResult, bool, error) {
+	job = u.keepInOutbox(job)
+	if u.pool != nil {
+		if u.pool.submit(job) {
+			logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unfolding queued.", job.tid, job.uuid, job.collectionType)
+			return unfoldingResult{}, true, nil
+		}
+		logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Async unfolding queue is full. Unfolding synchronously.", job.tid, job.uuid, job.collectionType)
+	}
+
+	defer job.done()
+	result, err := u.unfold(ctx, job)
+	return result, false, err
+}
+
+// validateCollectionUuid checks the uuid of the collection before it is locked, so that malformed uuids do not get
+// locks of their own.
+func validateCollectionUuid(tid string, uuid string, collectionType string) error {
+	if err := uuidutils.ValidateUUID(uuid); err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Invalid uuid in request path: %v", tid, uuid, collectionType, err)
+		return err
+	}
+	return nil
+}
+
+// lockCollection waits for the previous update of the collection to finish, its unfolding included, so that relations
+// are read after it was written and notifications are sent in the order of the updates.
+func (u *unfolder) lockCollection(tid string, uuid string, collectionType string) (*heldLock, error) {
+	release, err := u.locks.acquire(uuid)
+	if err != nil {
+		logger.Warnf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Skip forwarding and unfolding: %v", tid, uuid, collectionType, err)
+		return nil, err
 	}
+	return newHeldLock(release), nil
+}
+
+// withDeadline gives the context of a request the deadline every stage of the request draws its time from.
+func (u *unfolder) withDeadline(parent context.Context) (context.Context, context.CancelFunc) {
+	if u.requestDeadline <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, u.requestDeadline)
+}
 
+// upstreamErrorStatus answers a failed upstream call with 504 if the request ran out of its deadline,
+// and with 503 if the call was not made because the dependency is failing.
+func upstreamErrorStatus(ctx context.Context, err error) int {
+	if ctx.Err() == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, breaker.ErrOpen) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// schemaError lists the parts of a collection that do not match its schema.
+type schemaError struct {
+	violations []schema.Violation
+}
+
+func (e *schemaError) Error() string {
+	return "collection does not match its schema"
+}
+
+// writerError is the response of a writer that did not accept the collection. It is returned to the client as is.
+type writerError struct {
+	response fw.ForwarderResponse
+}
+
+func (e *writerError) Error() string {
+	errorResp := map[string]interface{}{}
+	if err := json.Unmarshal(e.response.ResponseBody, &errorResp); err == nil {
+		if msg, ok := errorResp["message"].(string); ok {
+			return msg
+		}
+	}
+	if body := bytes.TrimSpace(e.response.ResponseBody); len(body) > 0 {
+		return string(body)
+	}
+	return fmt.Sprintf("writer returned status [%v]", e.response.Status)
+}
+
+// writePutError answers with the violations of a collection that does not match its schema, with the response of a
+// writer that did not accept it, or with the message of any other error.
+func writePutError(writer http.ResponseWriter, status int, err error) {
+	var violations *schemaError
+	var rejected *writerError
+	switch {
+	case errors.As(err, &violations):
+		writeMap(writer, status, map[string]interface{}{
+			"message":    err.Error(),
+			"violations": violations.violations,
+		})
+	case errors.As(err, &rejected):
+		writeResponse(writer, status, rejected.response.ResponseBody)
+	default:
+		writeError(writer, status, err)
+	}
+}
+
+type collectionChanges struct {
+	body         []byte
+	uuidsAndDate res.UuidsAndDate
+	oldRelations *relations.CCRelations
+	diff         differ.CollectionDiff
+	diffUuidsSet *set.Set
+}
+
+// incomingCollection is the collection in the body of a request, with its members, publish reference and lastModified.
+type incomingCollection struct {
+	body         []byte
+	uuidsAndDate res.UuidsAndDate
+	// parseErr is kept until the collection is validated, so that schema violations are reported first
+	parseErr error
+}
+
+// readBody reads the collection in the request body.
+// If the body cannot be read the error response is already written and false is returned.
+func readBody(writer http.ResponseWriter, req *http.Request, tid string, uuid string, collectionType string) ([]byte, bool) {
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Unable to extract request body: %v", tid, uuid, collectionType, err)
+		writeError(writer, http.StatusUnprocessableEntity, err)
+		return nil, false
+	}
+	return body, true
+}
+
+func (u *unfolder) parseCollection(uuid string, body []byte) incomingCollection {
+	uuidsAndDate, err := u.uuidsAndDateRes.Resolve(uuid, body)
+	return incomingCollection{body: body, uuidsAndDate: uuidsAndDate, parseErr: err}
+}
+
+// validateCollection returns a *schemaError if the collection does not match its schema, or the error it could not be
+// parsed with.
+func (u *unfolder) validateCollection(tid string, uuid string, collectionType string, collection incomingCollection) error {
+	if violations := u.schemas.For(collectionType).Validate(collection.body); len(violations) > 0 {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Collection does not match its schema: %v", tid, uuid, collectionType, violations)
+		return &schemaError{violations: violations}
+	}
+
+	if collection.parseErr != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while resolving UUIDs: %v", tid, uuid, collectionType, collection.parseErr)
+		return collection.parseErr
+	}
+	return nil
+}
+
+// resolveChanges diffs the incoming collection against the one currently stored.
+func (u *unfolder) resolveChanges(ctx context.Context, tid string, uuid string, collectionType string, collection incomingCollection) (collectionChanges, error) {
+	oldCollectionRelations, err := u.relationsResolver.ResolveContext(ctx, uuid, tid)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while fetching old collection relations: %v", tid, uuid, collectionType, err)
+		return collectionChanges{}, err
+	}
+
+	diff := u.collectionsDiffer.Diff(collection.uuidsAndDate.UuidArr, oldCollectionRelations.Contains)
+
+	return collectionChanges{
+		body:         collection.body,
+		uuidsAndDate: collection.uuidsAndDate,
+		oldRelations: oldCollectionRelations,
+		diff:         diff,
+		diffUuidsSet: diff.Changed(),
+	}, nil
+}
+
+// unfold resolves and sends the notifications of the job, keeping the undelivered ones in the outbox if there is one.
+func (u *unfolder) unfold(ctx context.Context, job unfoldingJob) (unfoldingResult, error) {
+	result, err := u.resolveAndSend(ctx, job)
+	u.settleOutbox(job, result, err)
+	return result, err
+}
+
+func (u *unfolder) resolveAndSend(ctx context.Context, job unfoldingJob) (unfoldingResult, error) {
 	requestTimeout := u.contentRes.GetRequestTimeout()
-	resolvedContentArr, err := u.contentRes.ResolveContentsNew(flattenToStringSlice(diffUuidsSet), tid, requestTimeout)
+	resolvedContentArr, err := u.contentRes.ResolveContentsContext(ctx, job.diffUuids, job.tid, requestTimeout)
+	if err != nil {
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while resolving contents: %v", job.tid, job.uuid, job.collectionType, err)
+		return unfoldingResult{}, err
+	}
 
+	logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Done unfolding. Preparing to send messages.", job.tid, job.uuid, job.collectionType)
+
+	outcomes, err := u.producer.SendContext(ctx, job.tid, job.lastModified, resolvedContentArr, job.options)
 	if err != nil {
-		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while resolving contents: %v", tid, uuid, collectionType, err)
-		writeError(writer, http.StatusInternalServerError, err)
-		return
+		logger.Errorf("Message with tid=%v contentCollectionUuid=%v collectionType=%v Error while sending messages: %v", job.tid, job.uuid, job.collectionType, err)
 	}
 
-	logger.Infof("Message with tid=%v contentCollectionUuid=%v collectionType=%v Done unfolding. Preparing to send messages.", tid, uuid, collectionType)
+	result := newUnfoldingResult(resolvedContentArr, outcomes)
+	result.sendErr = err
+	return result, nil
+}
+
+// isForced tells if the client asked to notify every member of the collection, even if the membership did not change.
+func isForced(req *http.Request) bool {
+	for _, value := range []string{req.URL.Query().Get(forceParam), req.Header.Get(forceHeader)} {
+		if forced, err := strconv.ParseBool(value); err == nil && forced {
+			return true
+		}
+	}
+	return false
+}
+
+// forcedPolicy notifies the unchanged and moved members too, so that every old and incoming member is notified.
+func forcedPolicy(unfoldingPolicy policy.Policy) policy.Policy {
+	unfoldingPolicy.NotifyUnchanged = true
+	return unfoldingPolicy
+}
 
-	u.producer.Send(tid, uuidsAndDate.LastModified, resolvedContentArr)
+// notificationUuids adds to the diff the members the policy asks to notify as well, the unchanged or moved ones
+// and the containers, and returns all the members to notify.
+func notificationUuids(changes collectionChanges, unfoldingPolicy policy.Policy, containers []string) []string {
+	if unfoldingPolicy.NotifyUnchanged {
+		for _, unchangedUuid := range changes.diff.Unchanged {
+			changes.diffUuidsSet.Add(unchangedUuid)
+		}
+	}
+
+	if unfoldingPolicy.NotifyUnchanged || unfoldingPolicy.NotifyReordered {
+		for _, move := range changes.diff.Moved {
+			changes.diffUuidsSet.Add(move.UUID)
+		}
+	}
+
+	for _, container := range containers {
+		changes.diffUuidsSet.Add(container)
+	}
+
+	return flattenToStringSlice(changes.diffUuidsSet)
+}
+
+func messageOptions(unfoldingPolicy policy.Policy, changes map[string]string) prod.MessageOptions {
+	return prod.MessageOptions{
+		MessageType:    unfoldingPolicy.MessageType,
+		OriginSystemID: unfoldingPolicy.OriginSystemID,
+		Topic:          unfoldingPolicy.Topic,
+		Changes:        changes,
+	}
+}
+
+// changeTypes tells the producer what the update did to each member. The lead article is not a member, so it gets none.
+func changeTypes(diff differ.CollectionDiff) map[string]string {
+	changes := map[string]string{}
+	for _, addedUuid := range diff.Added {
+		changes[addedUuid] = prod.ChangeAdded
+	}
+	for _, removedUuid := range diff.Removed {
+		changes[removedUuid] = prod.ChangeRemoved
+	}
+	for _, unchangedUuid := range diff.Unchanged {
+		changes[unchangedUuid] = prod.ChangeUnchanged
+	}
+	for _, move := range diff.Moved {
+		changes[move.UUID] = prod.ChangeMoved
+	}
+	return changes
 }
 
 func flattenToStringSlice(set *set.Set) []string {
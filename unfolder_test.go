@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Financial-Times/content-collection-unfolder/breaker"
+	"github.com/Financial-Times/content-collection-unfolder/differ"
 	"github.com/Financial-Times/content-collection-unfolder/forwarder"
+	"github.com/Financial-Times/content-collection-unfolder/idempotency"
+	"github.com/Financial-Times/content-collection-unfolder/policy"
+	prod "github.com/Financial-Times/content-collection-unfolder/producer"
 	"github.com/Financial-Times/content-collection-unfolder/relations"
 	"github.com/Financial-Times/content-collection-unfolder/resolver"
+	"github.com/Financial-Times/content-collection-unfolder/schema"
+	"github.com/Financial-Times/message-queue-go-producer/producer"
 	"github.com/Financial-Times/transactionid-utils-go"
 	"github.com/Workiva/go-datastructures/set"
 	"github.com/gorilla/mux"
@@ -33,18 +43,54 @@ func TestInvalidUuid(t *testing.T) {
 
 	tid := transactionidutils.NewTransactionID()
 	req := buildRequest(t, server.URL, whitelistedCollection, invalidUuid, readTestFile(t, inputFile), tid)
+	acquiredBefore := lockCounter("acquired")
 
 	resp, err := http.DefaultClient.Do(req)
 	assert.NoError(t, err)
 
 	verifyResponse(t, http.StatusBadRequest, tid, resp)
+	assert.Equal(t, acquiredBefore, lockCounter("acquired"), "malformed uuids must not be locked")
 
-	mur.AssertNotCalled(t, "Resolve", mock.Anything)
+	mur.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
 	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
-	mcd.AssertNotCalled(t, "SymmetricDifference", mock.Anything, mock.Anything)
+	mcd.AssertNotCalled(t, "Diff", mock.Anything, mock.Anything)
 	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSchemaViolations(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := []byte(`{"uuid": "` + collectionUuid + `", "items": [{"uuid": 42}]}`)
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(resolver.UuidsAndDate{}, errors.New("uuid resolver error"))
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusBadRequest, tid, resp)
+
+	var respBody struct {
+		Violations []schema.Violation `json:"violations"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+	assert.Equal(t, []schema.Violation{
+		{Pointer: "", Message: "lastModified is required"},
+		{Pointer: "/items/0/uuid", Message: "Invalid type. Expected: string, given: integer"},
+	}, respBody.Violations)
+
+	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
+	mcd.AssertNotCalled(t, "Diff", mock.Anything, mock.Anything)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestUuidResolverError(t *testing.T) {
@@ -57,7 +103,7 @@ func TestUuidResolverError(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).
 		Return(resolver.UuidsAndDate{}, errors.New("uuid resolver error"))
 
 	resp, err := http.DefaultClient.Do(req)
@@ -68,10 +114,10 @@ func TestUuidResolverError(t *testing.T) {
 
 	mur.AssertExpectations(t)
 	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
-	mcd.AssertNotCalled(t, "SymmetricDifference", mock.Anything, mock.Anything)
+	mcd.AssertNotCalled(t, "Diff", mock.Anything, mock.Anything)
 	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestRelationsResolverError(t *testing.T) {
@@ -89,7 +135,7 @@ func TestRelationsResolverError(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
@@ -102,10 +148,10 @@ func TestRelationsResolverError(t *testing.T) {
 	verifyResponse(t, http.StatusInternalServerError, tid, resp)
 
 	mock.AssertExpectationsForObjects(t, mur, mrr)
-	mcd.AssertNotCalled(t, "SymmetricDifference", mock.Anything, mock.Anything)
+	mcd.AssertNotCalled(t, "Diff", mock.Anything, mock.Anything)
 	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestForwarderError(t *testing.T) {
@@ -119,9 +165,7 @@ func TestForwarderError(t *testing.T) {
 		ContainedIn: leadArticleUuid,
 		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
 	}
-	diffUuidsSet := set.New()
-	diffUuidsSet.Add(addedItemUuid)
-	diffUuidsSet.Add(deletedItemUuid)
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
 
 	server := startTestServer(u)
 	defer server.Close()
@@ -130,15 +174,15 @@ func TestForwarderError(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, collectionUuid)),
@@ -154,7 +198,7 @@ func TestForwarderError(t *testing.T) {
 
 	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestForwarderNon200Response(t *testing.T) {
@@ -168,9 +212,7 @@ func TestForwarderNon200Response(t *testing.T) {
 		ContainedIn: leadArticleUuid,
 		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
 	}
-	diffUuidsSet := set.New()
-	diffUuidsSet.Add(addedItemUuid)
-	diffUuidsSet.Add(deletedItemUuid)
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
 
 	server := startTestServer(u)
 	defer server.Close()
@@ -179,15 +221,15 @@ func TestForwarderNon200Response(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	fwResp := forwarder.ForwarderResponse{Status: http.StatusUnprocessableEntity, ResponseBody: []byte(errorJson)}
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
@@ -208,7 +250,7 @@ func TestForwarderNon200Response(t *testing.T) {
 
 	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestNotWhitelistedCollectionType(t *testing.T) {
@@ -222,9 +264,7 @@ func TestNotWhitelistedCollectionType(t *testing.T) {
 		ContainedIn: leadArticleUuid,
 		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
 	}
-	diffUuidsSet := set.New()
-	diffUuidsSet.Add(addedItemUuid)
-	diffUuidsSet.Add(deletedItemUuid)
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
 
 	server := startTestServer(u)
 	defer server.Close()
@@ -233,15 +273,15 @@ func TestNotWhitelistedCollectionType(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, ignoredCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, collectionUuid)),
@@ -255,7 +295,13 @@ func TestNotWhitelistedCollectionType(t *testing.T) {
 
 	verifyResponse(t, http.StatusOK, tid, resp)
 
+	report := readReport(t, resp)
+	assert.Equal(t, unfoldingSkipped, report.Unfolding)
+	assert.Equal(t, []string{addedItemUuid}, report.Added)
+	assert.Equal(t, []string{deletedItemUuid}, report.Removed)
+
 	mur.AssertCalled(t, "Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(func(actualReqBody []byte) bool {
 			assert.Equal(t, body, actualReqBody)
 			return true
@@ -263,7 +309,7 @@ func TestNotWhitelistedCollectionType(t *testing.T) {
 
 	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestContentResolverError(t *testing.T) {
@@ -277,9 +323,9 @@ func TestContentResolverError(t *testing.T) {
 		ContainedIn: leadArticleUuid,
 		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
 	}
-	diffUuidsSet := set.New()
-	diffUuidsSet.Add(addedItemUuid)
-	diffUuidsSet.Add(deletedItemUuid)
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
+	expectedUuids := diff.Changed()
+	expectedUuids.Add(leadArticleUuid)
 
 	server := startTestServer(u)
 	defer server.Close()
@@ -288,15 +334,15 @@ func TestContentResolverError(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, collectionUuid)),
@@ -305,7 +351,7 @@ func TestContentResolverError(t *testing.T) {
 		Return(forwarder.ForwarderResponse{http.StatusOK, []byte{}}, nil)
 
 	mcr.On("ResolveContentsNew",
-		mock.MatchedBy(expectSet(t, diffUuidsSet)),
+		mock.MatchedBy(expectSet(t, expectedUuids)),
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
 		Return([]map[string]interface{}{}, errors.New("content resolver error"))
@@ -317,7 +363,7 @@ func TestContentResolverError(t *testing.T) {
 	verifyResponse(t, http.StatusInternalServerError, tid, resp)
 
 	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestAllOk(t *testing.T) {
@@ -331,14 +377,19 @@ func TestAllOk(t *testing.T) {
 		ContainedIn: leadArticleUuid,
 		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
 	}
-	diffUuidsSet := set.New()
-	diffUuidsSet.Add(addedItemUuid)
-	diffUuidsSet.Add(deletedItemUuid)
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
+	expectedUuids := diff.Changed()
+	expectedUuids.Add(leadArticleUuid)
 
 	contentArr := []map[string]interface{}{
-		{addedItemUuid: addedItemUuid},
-		{deletedItemUuid: deletedItemUuid},
-		{leadArticleUuid: leadArticleUuid},
+		{"uuid": addedItemUuid},
+		{"uuid": deletedItemUuid},
+		{"uuid": leadArticleUuid},
+	}
+	outcomes := []prod.SendOutcome{
+		{UUID: addedItemUuid},
+		{UUID: deletedItemUuid, Err: errors.New("kafka error")},
+		{UUID: leadArticleUuid},
 	}
 
 	server := startTestServer(u)
@@ -348,15 +399,15 @@ func TestAllOk(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, collectionUuid)),
@@ -364,14 +415,16 @@ func TestAllOk(t *testing.T) {
 		mock.MatchedBy(expectByteSlice(t, body))).
 		Return(forwarder.ForwarderResponse{http.StatusOK, []byte{}}, nil)
 	mcr.On("ResolveContentsNew",
-		mock.MatchedBy(expectSet(t, diffUuidsSet)),
+		mock.MatchedBy(expectSet(t, expectedUuids)),
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
 		Return(contentArr, nil)
 	mcp.On("Send",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, uuidsAndDate.LastModified)),
-		mock.MatchedBy(expectMap(t, contentArr)))
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: changeTypes(diff)}))).
+		Return(outcomes, &prod.SendError{Failed: outcomes[1:2], Total: 3})
 
 	resp, err := http.DefaultClient.Do(req)
 	assert.NoError(t, err)
@@ -379,9 +432,87 @@ func TestAllOk(t *testing.T) {
 
 	verifyResponse(t, http.StatusOK, tid, resp)
 
+	report := readReport(t, resp)
+	assert.Equal(t, http.StatusOK, report.WriterStatus)
+	assert.Equal(t, unfoldingDone, report.Unfolding)
+	assert.Equal(t, []string{addedItemUuid}, report.Added)
+	assert.Equal(t, []string{deletedItemUuid}, report.Removed)
+	assert.Equal(t, leadArticleUuid, report.LeadArticle)
+	assert.Equal(t, []string{addedItemUuid, deletedItemUuid, leadArticleUuid}, report.Resolved)
+	assert.Equal(t, []string{addedItemUuid, leadArticleUuid}, report.Sent)
+	assert.Equal(t, []failedMessage{{UUID: deletedItemUuid, Reason: "kafka error"}}, report.Failed)
+
 	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
 }
 
+func TestSendFailurePolicies(t *testing.T) {
+	policies := map[string]int{
+		"report":       http.StatusOK,
+		"multi-status": http.StatusMultiStatus,
+		"fail":         http.StatusServiceUnavailable,
+	}
+
+	for policy, expectedStatus := range policies {
+		mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+		assert.NoError(t, u.setSendFailurePolicy(policy))
+
+		uuidsAndDate := resolver.UuidsAndDate{
+			UuidArr:      []string{addedItemUuid},
+			LastModified: lastModified,
+		}
+		oldRelations := relations.CCRelations{}
+		diff := differ.CollectionDiff{Added: []string{addedItemUuid}}
+		contentArr := []map[string]interface{}{{"uuid": addedItemUuid}}
+		outcomes := []prod.SendOutcome{{UUID: addedItemUuid, Err: errors.New("kafka error")}}
+
+		server := startTestServer(u)
+
+		tid := transactionidutils.NewTransactionID()
+		body := readTestFile(t, inputFile)
+		req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+
+		mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+		mrr.On("Resolve", mock.Anything, mock.Anything).Return(&oldRelations, nil)
+		mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+		mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+		mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).Return(contentArr, nil)
+		mcp.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(outcomes, &prod.SendError{Failed: outcomes, Total: 1})
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+
+		verifyResponse(t, expectedStatus, tid, resp)
+		report := readReport(t, resp)
+		assert.Equal(t, []failedMessage{{UUID: addedItemUuid, Reason: "kafka error"}}, report.Failed, policy)
+
+		resp.Body.Close()
+		server.Close()
+	}
+}
+
+func TestUnknownSendFailurePolicy(t *testing.T) {
+	_, _, _, _, _, _, u := newUnfolderWithMocks()
+
+	assert.Error(t, u.setSendFailurePolicy("ignore"))
+	assert.Equal(t, http.StatusOK, u.sendFailureStatus)
+}
+
+func TestFailPolicyNeedsOutbox(t *testing.T) {
+	_, _, _, _, _, _, u := newUnfolderWithMocks()
+	assert.NoError(t, u.setSendFailurePolicy("multi-status"))
+	assert.NoError(t, u.checkSendFailurePolicy())
+
+	assert.NoError(t, u.setSendFailurePolicy("fail"))
+	assert.Error(t, u.checkSendFailurePolicy())
+
+	o, cleanup := newTestOutbox(t)
+	defer cleanup()
+	u.outbox = o
+	assert.NoError(t, u.checkSendFailurePolicy())
+}
+
 func TestAllOk_NoLeadArticleRelation(t *testing.T) {
 	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
 
@@ -390,10 +521,8 @@ func TestAllOk_NoLeadArticleRelation(t *testing.T) {
 		LastModified: lastModified,
 	}
 	oldRelations := relations.CCRelations{}
-	diffUuidsSet := set.New()
-	diffUuidsSet.Add(firstExistingItemUuid)
-	diffUuidsSet.Add(addedItemUuid)
-	diffUuidsSet.Add(deletedItemUuid)
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}, Unchanged: []string{firstExistingItemUuid}}
+	diffUuidsSet := diff.Changed()
 	contentArr := []map[string]interface{}{
 		{firstExistingItemUuid: firstExistingItemUuid},
 		{secondExistingItemUuid: secondExistingItemUuid},
@@ -407,15 +536,15 @@ func TestAllOk_NoLeadArticleRelation(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, collectionUuid)),
@@ -436,7 +565,9 @@ func TestAllOk_NoLeadArticleRelation(t *testing.T) {
 	mcp.On("Send",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, uuidsAndDate.LastModified)),
-		mock.MatchedBy(expectMap(t, contentArr)))
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: changeTypes(diff)}))).
+		Return(outcomesFor(contentArr), nil)
 
 	resp, err := http.DefaultClient.Do(req)
 	assert.NoError(t, err)
@@ -455,7 +586,7 @@ func TestAllOk_NewEmptyCollection_NoRelations(t *testing.T) {
 		LastModified: lastModified,
 	}
 	oldRelations := relations.CCRelations{}
-	diffUuidsSet := set.New()
+	diff := differ.CollectionDiff{}
 
 	server := startTestServer(u)
 	defer server.Close()
@@ -464,15 +595,15 @@ func TestAllOk_NewEmptyCollection_NoRelations(t *testing.T) {
 	body := readTestFile(t, inputFile)
 	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
 
-	mur.On("Resolve", mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
 	mrr.On("Resolve",
 		mock.MatchedBy(expectString(t, collectionUuid)),
 		mock.MatchedBy(expectString(t, tid))).
 		Return(&oldRelations, nil)
-	mcd.On("SymmetricDifference",
+	mcd.On("Diff",
 		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
 		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
-		Return(diffUuidsSet)
+		Return(diff)
 	mf.On("Forward",
 		mock.MatchedBy(expectString(t, tid)),
 		mock.MatchedBy(expectString(t, collectionUuid)),
@@ -488,7 +619,629 @@ func TestAllOk_NewEmptyCollection_NoRelations(t *testing.T) {
 
 	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf)
 	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
-	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAllOk_AsyncUnfolding(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.enableAsyncUnfolding(1, 1)
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid, secondExistingItemUuid, addedItemUuid},
+		LastModified: lastModified,
+	}
+	oldRelations := relations.CCRelations{
+		ContainedIn: leadArticleUuid,
+		Contains:    []string{firstExistingItemUuid, secondExistingItemUuid, deletedItemUuid},
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}}
+	expectedUuids := diff.Changed()
+	expectedUuids.Add(leadArticleUuid)
+
+	contentArr := []map[string]interface{}{
+		{addedItemUuid: addedItemUuid},
+		{deletedItemUuid: deletedItemUuid},
+		{leadArticleUuid: leadArticleUuid},
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := readTestFile(t, inputFile)
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&oldRelations, nil)
+	mcd.On("Diff",
+		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
+		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
+		Return(diff)
+	mf.On("Forward",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, whitelistedCollection)),
+		mock.MatchedBy(expectByteSlice(t, body))).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK, ResponseBody: []byte{}}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(expectSet(t, expectedUuids)),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, uuidsAndDate.LastModified)),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: changeTypes(diff)}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusAccepted, tid, resp)
+
+	report := readReport(t, resp)
+	assert.Equal(t, unfoldingQueued, report.Unfolding)
+	assert.Empty(t, report.Sent)
+
+	u.drain(time.Second)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
+}
+
+func TestAllOk_UnfoldingPolicy(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.policies = policy.NewPolicies(map[string]policy.Policy{
+		whitelistedCollection: {Unfold: true, NotifyUnchanged: true, MessageType: "cms-content-collection-changed", Topic: "CuratedListEvents"},
+	})
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid, addedItemUuid},
+		LastModified: lastModified,
+	}
+	oldRelations := relations.CCRelations{
+		ContainedIn: leadArticleUuid,
+		Contains:    []string{firstExistingItemUuid, deletedItemUuid},
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}, Removed: []string{deletedItemUuid}, Unchanged: []string{firstExistingItemUuid}}
+	contentArr := []map[string]interface{}{
+		{firstExistingItemUuid: firstExistingItemUuid},
+		{addedItemUuid: addedItemUuid},
+		{deletedItemUuid: deletedItemUuid},
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := readTestFile(t, inputFile)
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+
+	mur.On("Resolve", mock.MatchedBy(expectString(t, collectionUuid)), mock.MatchedBy(expectByteSlice(t, body))).Return(uuidsAndDate, nil)
+	mrr.On("Resolve",
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, tid))).
+		Return(&oldRelations, nil)
+	mcd.On("Diff",
+		mock.MatchedBy(expectStringSlice(t, uuidsAndDate.UuidArr)),
+		mock.MatchedBy(expectStringSlice(t, oldRelations.Contains))).
+		Return(diff)
+	mf.On("Forward",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, collectionUuid)),
+		mock.MatchedBy(expectString(t, whitelistedCollection)),
+		mock.MatchedBy(expectByteSlice(t, body))).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK, ResponseBody: []byte{}}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(func(actualDiffUuids []string) bool {
+			assert.ElementsMatch(t, []string{firstExistingItemUuid, addedItemUuid, deletedItemUuid}, actualDiffUuids)
+			return true
+		}),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, uuidsAndDate.LastModified)),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{
+			MessageType: "cms-content-collection-changed",
+			Topic:       "CuratedListEvents",
+			Changes: map[string]string{
+				firstExistingItemUuid: prod.ChangeUnchanged,
+				addedItemUuid:         prod.ChangeAdded,
+				deletedItemUuid:       prod.ChangeRemoved,
+			},
+		}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
+}
+
+func TestAllOk_NotifyReordered(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.policies = policy.NewPolicies(map[string]policy.Policy{
+		whitelistedCollection: {Unfold: true, NotifyReordered: true},
+	})
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{secondExistingItemUuid, firstExistingItemUuid},
+		LastModified: lastModified,
+	}
+	oldRelations := relations.CCRelations{
+		Contains: []string{firstExistingItemUuid, secondExistingItemUuid},
+	}
+	diff := differ.CollectionDiff{
+		Unchanged: []string{secondExistingItemUuid},
+		Moved:     []differ.Move{{UUID: firstExistingItemUuid, From: 0, To: 1}},
+	}
+	contentArr := []map[string]interface{}{{"uuid": firstExistingItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := readTestFile(t, inputFile)
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&oldRelations, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(expectStringSlice(t, []string{firstExistingItemUuid})),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, lastModified)),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: map[string]string{
+			secondExistingItemUuid: prod.ChangeUnchanged,
+			firstExistingItemUuid:  prod.ChangeMoved,
+		}}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	report := readReport(t, resp)
+	assert.Equal(t, unfoldingDone, report.Unfolding)
+	assert.Equal(t, diff.Moved, report.Moved)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
+}
+
+func TestAllOk_Forced(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{firstExistingItemUuid, secondExistingItemUuid},
+		LastModified: lastModified,
+	}
+	oldRelations := relations.CCRelations{
+		Contains: []string{firstExistingItemUuid, secondExistingItemUuid},
+	}
+	diff := differ.CollectionDiff{
+		Unchanged: []string{firstExistingItemUuid, secondExistingItemUuid},
+	}
+	expectedUuids := set.New(firstExistingItemUuid, secondExistingItemUuid)
+	contentArr := []map[string]interface{}{{"uuid": firstExistingItemUuid}, {"uuid": secondExistingItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	body := readTestFile(t, inputFile)
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, body, tid)
+	req.URL.RawQuery = forceParam + "=true"
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&oldRelations, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew",
+		mock.MatchedBy(expectSet(t, expectedUuids)),
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectTimeDuration(t, requestTimeout))).
+		Return(contentArr, nil)
+	mcp.On("Send",
+		mock.MatchedBy(expectString(t, tid)),
+		mock.MatchedBy(expectString(t, lastModified)),
+		mock.MatchedBy(expectMap(t, contentArr)),
+		mock.MatchedBy(expectOptions(t, prod.MessageOptions{Changes: map[string]string{
+			firstExistingItemUuid:  prod.ChangeUnchanged,
+			secondExistingItemUuid: prod.ChangeUnchanged,
+		}}))).
+		Return(outcomesFor(contentArr), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+
+	report := readReport(t, resp)
+	assert.Equal(t, unfoldingDone, report.Unfolding)
+	assert.True(t, report.Forced)
+
+	mock.AssertExpectationsForObjects(t, mur, mrr, mcd, mf, mcr, mcp)
+}
+
+func TestIsForced(t *testing.T) {
+	tests := []struct {
+		query    string
+		header   string
+		expected bool
+	}{
+		{"", "", false},
+		{"force=true", "", true},
+		{"force=false", "", false},
+		{"force=yes", "", false},
+		{"", "true", true},
+		{"", "1", true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/?"+test.query, nil)
+		if test.header != "" {
+			req.Header.Set(forceHeader, test.header)
+		}
+		assert.Equal(t, test.expected, isForced(req), "query [%v] header [%v]", test.query, test.header)
+	}
+}
+
+func TestRequestDeadlineAbortsSlowWriter(t *testing.T) {
+	mur, mrr, mcd, _, mcr, mcp, u := newUnfolderWithMocks()
+	u.setRequestDeadline(50 * time.Millisecond)
+
+	released := make(chan struct{})
+	slowWriter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-released:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slowWriter.Close()
+	defer close(released)
+	u.forwarder = forwarder.NewForwarder(http.DefaultClient, slowWriter.URL)
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{addedItemUuid},
+		LastModified: lastModified,
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&relations.CCRelations{}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(differ.CollectionDiff{Added: []string{addedItemUuid}})
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusGatewayTimeout, tid, resp)
+	assert.True(t, time.Since(start) < 5*time.Second, "the call to the writer should be aborted at the deadline")
+
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOpenBreakerFailsFast(t *testing.T) {
+	mur, _, _, mf, mcr, mcp, u := newUnfolderWithMocks()
+
+	var calls int32
+	failingRelations := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingRelations.Close()
+	relationsBreaker := breaker.New("relations-api", breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute})
+	u.relationsResolver = relations.NewDefaultRelationsResolver(relationsBreaker.Client(http.DefaultClient), failingRelations.URL+"/{uuid}")
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(resolver.UuidsAndDate{UuidArr: []string{addedItemUuid}, LastModified: lastModified}, nil)
+
+	for _, expectedStatus := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		tid := transactionidutils.NewTransactionID()
+		req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		verifyResponse(t, expectedStatus, tid, resp)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRepeatedPublishIsReplayed(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.enableIdempotency(idempotency.NewMemoryStore(10, time.Minute))
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:          []string{addedItemUuid},
+		LastModified:     lastModified,
+		PublishReference: "tid_publish",
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}}
+	contentArr := []map[string]interface{}{{"uuid": addedItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&relations.CCRelations{}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).Return(contentArr, nil)
+	mcp.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(outcomesFor(contentArr), nil)
+
+	var bodies [][]byte
+	for i := 0; i < 2; i++ {
+		tid := transactionidutils.NewTransactionID()
+		req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+
+		verifyResponse(t, http.StatusOK, tid, resp)
+		assert.Equal(t, i == 1, resp.Header.Get(replayHeader) == "true")
+
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, body)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, bodies[0], bodies[1])
+	mrr.AssertNumberOfCalls(t, "Resolve", 1)
+	mf.AssertNumberOfCalls(t, "Forward", 1)
+	mcp.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestRepeatedPublishIsReplayedWithoutWaitingForTheLock(t *testing.T) {
+	mur, mrr, _, mf, _, _, u := newUnfolderWithMocks()
+	u.enableIdempotency(idempotency.NewMemoryStore(10, time.Minute))
+	u.setCollectionLockTimeout(10 * time.Millisecond)
+
+	publish := idempotency.Key{CollectionUUID: collectionUuid, PublishReference: "tid_publish", LastModified: lastModified}
+	u.publishes.Put(publish, idempotency.Outcome{Status: http.StatusOK, Body: []byte(`{"unfolding":"done"}`)})
+
+	release, err := u.locks.acquire(collectionUuid)
+	assert.NoError(t, err)
+	defer release()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).
+		Return(resolver.UuidsAndDate{LastModified: lastModified, PublishReference: "tid_publish"}, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+	assert.Equal(t, "true", resp.Header.Get(replayHeader))
+
+	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// missFirstGet is a store whose first lookup misses, like the lookup of a repeat made before the publish it repeats
+// was processed.
+type missFirstGet struct {
+	idempotency.Store
+	missed int32
+}
+
+func (s *missFirstGet) Get(key idempotency.Key) (idempotency.Outcome, bool) {
+	if atomic.CompareAndSwapInt32(&s.missed, 0, 1) {
+		return idempotency.Outcome{}, false
+	}
+	return s.Store.Get(key)
+}
+
+func TestRepeatedPublishIsReplayedAfterWaitingForTheLock(t *testing.T) {
+	mur, mrr, _, mf, _, _, u := newUnfolderWithMocks()
+	u.enableIdempotency(&missFirstGet{Store: idempotency.NewMemoryStore(10, time.Minute)})
+
+	publish := idempotency.Key{CollectionUUID: collectionUuid, PublishReference: "tid_publish", LastModified: lastModified}
+	u.publishes.Put(publish, idempotency.Outcome{Status: http.StatusOK, Body: []byte(`{"unfolding":"done"}`)})
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).
+		Return(resolver.UuidsAndDate{UuidArr: []string{addedItemUuid}, LastModified: lastModified, PublishReference: "tid_publish"}, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusOK, tid, resp)
+	assert.Equal(t, "true", resp.Header.Get(replayHeader))
+
+	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestForcedPublishIsNotRecorded(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.enableIdempotency(idempotency.NewMemoryStore(10, time.Minute))
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:          []string{addedItemUuid},
+		LastModified:     lastModified,
+		PublishReference: "tid_publish",
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}}
+	contentArr := []map[string]interface{}{{"uuid": addedItemUuid}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&relations.CCRelations{}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).Return(contentArr, nil)
+	mcp.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(outcomesFor(contentArr), nil)
+
+	for i, forced := range []bool{true, false, false} {
+		tid := transactionidutils.NewTransactionID()
+		req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+		if forced {
+			req.Header.Set(forceHeader, "true")
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+
+		verifyResponse(t, http.StatusOK, tid, resp)
+		assert.Equal(t, i == 2, resp.Header.Get(replayHeader) == "true")
+		assert.False(t, readReport(t, resp).Forced && !forced, "a forced outcome must not be replayed")
+		resp.Body.Close()
+	}
+
+	mf.AssertNumberOfCalls(t, "Forward", 2)
+}
+
+func TestFailedPublishIsNotReplayed(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.enableIdempotency(idempotency.NewMemoryStore(10, time.Minute))
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:          []string{addedItemUuid},
+		LastModified:     lastModified,
+		PublishReference: "tid_publish",
+	}
+	diff := differ.CollectionDiff{Added: []string{addedItemUuid}}
+	contentArr := []map[string]interface{}{{"uuid": addedItemUuid}}
+	outcomes := []prod.SendOutcome{{UUID: addedItemUuid, Err: errors.New("kafka error")}}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&relations.CCRelations{}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(diff)
+	mf.On("Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(forwarder.ForwarderResponse{Status: http.StatusOK}, nil)
+	mcr.On("ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything).Return(contentArr, nil)
+	mcp.On("Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(outcomes, &prod.SendError{Failed: outcomes, Total: 1})
+
+	for i := 0; i < 2; i++ {
+		tid := transactionidutils.NewTransactionID()
+		req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		verifyResponse(t, http.StatusOK, tid, resp)
+		assert.Empty(t, resp.Header.Get(replayHeader))
+		resp.Body.Close()
+	}
+
+	mf.AssertNumberOfCalls(t, "Forward", 2)
+	mcp.AssertNumberOfCalls(t, "Send", 2)
+}
+
+func TestStaleUpdateIsRejected(t *testing.T) {
+	mur, mrr, mcd, mf, mcr, mcp, u := newUnfolderWithMocks()
+	u.freshness.accept(collectionUuid, "2017-02-01T10:00:00.000Z")
+
+	uuidsAndDate := resolver.UuidsAndDate{
+		UuidArr:      []string{addedItemUuid},
+		LastModified: lastModified,
+	}
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(uuidsAndDate, nil)
+	mrr.On("Resolve", mock.Anything, mock.Anything).Return(&relations.CCRelations{}, nil)
+	mcd.On("Diff", mock.Anything, mock.Anything).Return(differ.CollectionDiff{Added: []string{addedItemUuid}})
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusConflict, tid, resp)
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(respBody), "older than the one of the last accepted update")
+
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mcr.AssertNotCalled(t, "ResolveContentsNew", mock.Anything, mock.Anything, mock.Anything)
+	mcp.AssertNotCalled(t, "Send", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestConcurrentUpdateOfTheSameCollectionTimesOut(t *testing.T) {
+	mur, mrr, _, mf, _, _, u := newUnfolderWithMocks()
+	u.setCollectionLockTimeout(10 * time.Millisecond)
+
+	release, err := u.locks.acquire(collectionUuid)
+	assert.NoError(t, err)
+	defer release()
+
+	server := startTestServer(u)
+	defer server.Close()
+
+	tid := transactionidutils.NewTransactionID()
+	req := buildRequest(t, server.URL, whitelistedCollection, collectionUuid, readTestFile(t, inputFile), tid)
+
+	mur.On("Resolve", mock.Anything, mock.Anything).Return(resolver.UuidsAndDate{LastModified: lastModified}, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	verifyResponse(t, http.StatusServiceUnavailable, tid, resp)
+
+	mrr.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything)
+	mf.AssertNotCalled(t, "Forward", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 func TestMarshallingErrorIs500(t *testing.T) {
@@ -506,17 +1259,40 @@ func newUnfolderWithMocks() (*mockUuidResolver, *mockRelationsResolver, *mockCol
 	mf := new(mockForwarder)
 	mcr := new(mockContentResolver)
 	mcp := new(mockContentProducer)
-	u := newUnfolder(mur, mrr, mcd, mf, mcr, mcp, []string{whitelistedCollection})
+	u := newUnfolder(mur, mrr, mcd, mf, mcr, mcp, policy.FromWhitelist([]string{whitelistedCollection}))
 	return mur, mrr, mcd, mf, mcr, mcp, u
 }
 
 func startTestServer(u *unfolder) *httptest.Server {
 	router := mux.NewRouter()
 	router.HandleFunc(unfolderPath, u.handle).Methods(http.MethodPut)
+	router.HandleFunc(unfolderPath, u.handleDelete).Methods(http.MethodDelete)
+	router.HandleFunc(previewPath, u.handlePreview).Methods(http.MethodPost)
+	router.HandleFunc(republishPath, u.handleRepublish).Methods(http.MethodPost)
+	router.HandleFunc(batchPath, u.handleBatch).Methods(http.MethodPost)
 
 	return httptest.NewServer(router)
 }
 
+func readReport(t *testing.T, resp *http.Response) unfoldingReport {
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	report := unfoldingReport{}
+	assert.NoError(t, json.Unmarshal(body, &report))
+	return report
+}
+
+func outcomesFor(contents []map[string]interface{}) []prod.SendOutcome {
+	outcomes := []prod.SendOutcome{}
+	for _, content := range contents {
+		if uuid, ok := content["uuid"].(string); ok {
+			outcomes = append(outcomes, prod.SendOutcome{UUID: uuid})
+		}
+	}
+	return outcomes
+}
+
 func verifyResponse(t *testing.T, expectedStatus int, expectedTid string, resp *http.Response) {
 	assert.Equal(t, expectedStatus, resp.StatusCode)
 	assert.Equal(t, expectedTid, resp.Header.Get(transactionidutils.TransactionIDHeader))
@@ -532,12 +1308,27 @@ func (mf *mockForwarder) Forward(tid string, uuid string, collectionType string,
 	return args.Get(0).(forwarder.ForwarderResponse), args.Error(1)
 }
 
+func (mf *mockForwarder) Delete(tid string, uuid string, collectionType string) (forwarder.ForwarderResponse, error) {
+	args := mf.Called(tid, uuid, collectionType)
+	return args.Get(0).(forwarder.ForwarderResponse), args.Error(1)
+}
+
+// The context variants of the mocks record their calls under the name of the plain method.
+
+func (mf *mockForwarder) ForwardContext(ctx context.Context, tid string, uuid string, collectionType string, reqBody []byte) (forwarder.ForwarderResponse, error) {
+	return mf.Forward(tid, uuid, collectionType, reqBody)
+}
+
+func (mf *mockForwarder) DeleteContext(ctx context.Context, tid string, uuid string, collectionType string) (forwarder.ForwarderResponse, error) {
+	return mf.Delete(tid, uuid, collectionType)
+}
+
 type mockUuidResolver struct {
 	mock.Mock
 }
 
-func (mur *mockUuidResolver) Resolve(reqData []byte) (resolver.UuidsAndDate, error) {
-	args := mur.Called(reqData)
+func (mur *mockUuidResolver) Resolve(collectionUUID string, reqData []byte) (resolver.UuidsAndDate, error) {
+	args := mur.Called(collectionUUID, reqData)
 	return args.Get(0).(resolver.UuidsAndDate), args.Error(1)
 }
 
@@ -555,6 +1346,10 @@ func (mcr *mockContentResolver) ResolveContentsNew(diffUuids []string, tid strin
 	return args.Get(0).([]map[string]interface{}), args.Error(1)
 }
 
+func (mcr *mockContentResolver) ResolveContentsContext(ctx context.Context, diffUuids []string, tid string, requestTimeout time.Duration) ([]map[string]interface{}, error) {
+	return mcr.ResolveContentsNew(diffUuids, tid, requestTimeout)
+}
+
 func (mcr *mockContentResolver) GetRequestTimeout() time.Duration {
 	return requestTimeout
 }
@@ -563,9 +1358,18 @@ type mockContentProducer struct {
 	mock.Mock
 }
 
-func (mcp *mockContentProducer) Send(tid string, lastModified string, contents []map[string]interface{}) {
-	mcp.Called(tid, lastModified, contents)
-	return
+func (mcp *mockContentProducer) Send(tid string, lastModified string, contents []map[string]interface{}, opts prod.MessageOptions) ([]prod.SendOutcome, error) {
+	args := mcp.Called(tid, lastModified, contents, opts)
+	return args.Get(0).([]prod.SendOutcome), args.Error(1)
+}
+
+func (mcp *mockContentProducer) SendContext(ctx context.Context, tid string, lastModified string, contents []map[string]interface{}, opts prod.MessageOptions) ([]prod.SendOutcome, error) {
+	return mcp.Send(tid, lastModified, contents, opts)
+}
+
+func (mcp *mockContentProducer) BuildMessages(tid string, lastModified string, contents []map[string]interface{}, opts prod.MessageOptions) []producer.Message {
+	args := mcp.Called(tid, lastModified, contents, opts)
+	return args.Get(0).([]producer.Message)
 }
 
 type mockRelationsResolver struct {
@@ -577,10 +1381,19 @@ func (mrr *mockRelationsResolver) Resolve(contentCollectionUUID string, tid stri
 	return args.Get(0).(*relations.CCRelations), args.Error(1)
 }
 
+func (mrr *mockRelationsResolver) ResolveContext(ctx context.Context, contentCollectionUUID string, tid string) (*relations.CCRelations, error) {
+	return mrr.Resolve(contentCollectionUUID, tid)
+}
+
 type mockCollectionsDiffer struct {
 	mock.Mock
 }
 
+func (mcd *mockCollectionsDiffer) Diff(incomingCollectionUuids []string, oldCollectionUuids []string) differ.CollectionDiff {
+	args := mcd.Called(incomingCollectionUuids, oldCollectionUuids)
+	return args.Get(0).(differ.CollectionDiff)
+}
+
 func (mcd *mockCollectionsDiffer) SymmetricDifference(incomingCollectionUuids []string, oldCollectionUuids []string) *set.Set {
 	args := mcd.Called(incomingCollectionUuids, oldCollectionUuids)
 	return args.Get(0).(*set.Set)
@@ -632,9 +1445,22 @@ func expectMap(t *testing.T, expected []map[string]interface{}) func([]map[strin
 	}
 }
 
+func expectOptions(t *testing.T, expected prod.MessageOptions) func(prod.MessageOptions) bool {
+	return func(actual prod.MessageOptions) bool {
+		assert.Equal(t, expected, actual)
+		return true
+	}
+}
+
 func expectTimeDuration(t *testing.T, expected time.Duration) func(time.Duration) bool {
 	return func(actual time.Duration) bool {
 		assert.Equal(t, expected, actual)
 		return true
 	}
 }
+
+func TestWriterErrorMessage(t *testing.T) {
+	assert.Equal(t, "error", (&writerError{response: forwarder.ForwarderResponse{Status: http.StatusNotFound, ResponseBody: []byte(`{"message":"error"}`)}}).Error())
+	assert.Equal(t, "not found", (&writerError{response: forwarder.ForwarderResponse{Status: http.StatusNotFound, ResponseBody: []byte(" not found\n")}}).Error())
+	assert.Equal(t, "writer returned status [404]", (&writerError{response: forwarder.ForwarderResponse{Status: http.StatusNotFound}}).Error())
+}